@@ -0,0 +1,147 @@
+package infux
+
+import "sync/atomic"
+
+// AdmissionPolicy selects whether a bounded cache stores a new item that
+// would make it evict another one.
+type AdmissionPolicy int
+
+const (
+	// AdmitAll admits every new item, evicting as the EvictionPolicy
+	// chooses to make room for it.
+	AdmitAll AdmissionPolicy = iota
+
+	// TinyLFU admits a new item that would make the cache evict only if
+	// the item's key has been used more often, recently, than the key of
+	// the item the eviction policy would evict from the new item's shard.
+	// Otherwise the write is dropped, leaving that item in place. Keys
+	// used once, as in a scan, thus cannot push out the keys used over
+	// and over, and the hit ratio of workloads mixing the two improves.
+	//
+	// Uses are counted in a count-min sketch of 4-bit counters shared by
+	// the whole cache, sized from MaxEntries, or MaxEntriesPerShard times
+	// the number of shards, at 2 bytes per item. Every lookup, hit or
+	// miss, and every write counts as a use of its key. To let old
+	// popularity fade, all counters are halved once the sketch has
+	// counted ten uses per counter of a row. A write to a key the cache
+	// already holds is always admitted.
+	TinyLFU
+)
+
+const (
+	// sketchRows is the number of rows of the frequency sketch, each
+	// counting every key in one counter of its own.
+	sketchRows = 4
+	// sketchDefaultWidth is the number of counters per row of a sketch
+	// for a cache limited by neither MaxEntries nor MaxEntriesPerShard.
+	sketchDefaultWidth = 1 << 16
+	// sketchMinWidth is the minimum number of counters per row.
+	sketchMinWidth = 64
+	// sketchAgingFactor is the number of uses per counter of a row after
+	// which all counters are halved.
+	sketchAgingFactor = 10
+)
+
+// frequencySketch is a count-min sketch estimating how often keys were
+// used: each key has a 4-bit counter in every row, and its estimate is
+// the smallest of them, which overestimates the count only when every
+// one of its counters is shared with other keys. Counters are packed 16
+// to a word and updated atomically, so the sketch needs no lock.
+type frequencySketch struct {
+	words []atomic.Uint64
+	// mask is the number of counters per row minus one.
+	mask uint64
+	// uses counts increments, to halve the counters every resetAt.
+	uses    atomic.Uint64
+	resetAt uint64
+	// rejections counts the writes TinyLFU dropped.
+	rejections atomic.Uint64
+}
+
+// newFrequencySketch returns an empty sketch with at least width counters
+// per row.
+func newFrequencySketch(width int) *frequencySketch {
+	n := sketchMinWidth
+	for n < width {
+		n *= 2
+	}
+	return &frequencySketch{
+		words:   make([]atomic.Uint64, sketchRows*n/16),
+		mask:    uint64(n - 1),
+		resetAt: uint64(sketchAgingFactor * n),
+	}
+}
+
+// counter returns the word and bit offset of the counter of row for the
+// key with bloom hash h.
+func (s *frequencySketch) counter(h uint64, row uint64) (*atomic.Uint64, uint64) {
+	h1, h2 := h, h>>32|1
+	i := row*(s.mask+1) + (h1+row*h2)&s.mask
+	return &s.words[i/16], i % 16 * 4
+}
+
+// increment counts a use of the key with bloom hash h.
+func (s *frequencySketch) increment(h uint64) {
+	for row := uint64(0); row < sketchRows; row++ {
+		word, shift := s.counter(h, row)
+		for {
+			old := word.Load()
+			if old>>shift&0xf == 0xf || word.CompareAndSwap(old, old+1<<shift) {
+				break
+			}
+		}
+	}
+	if s.uses.Add(1)%s.resetAt == 0 {
+		s.age()
+	}
+}
+
+// estimate returns the estimated number of uses of the key with bloom
+// hash h.
+func (s *frequencySketch) estimate(h uint64) uint64 {
+	least := uint64(0xf)
+	for row := uint64(0); row < sketchRows; row++ {
+		word, shift := s.counter(h, row)
+		least = min(least, word.Load()>>shift&0xf)
+	}
+	return least
+}
+
+// age halves every counter. Increments racing with it may be lost.
+func (s *frequencySketch) age() {
+	for i := range s.words {
+		word := &s.words[i]
+		for {
+			old := word.Load()
+			if word.CompareAndSwap(old, old>>1&0x7777777777777777) {
+				break
+			}
+		}
+	}
+}
+
+// admitLocked counts the write of e for TinyLFU and reports whether e may
+// be stored in shard. The caller must hold the shard's write lock.
+func (c *Cache) admitLocked(shard *cacheShard, e *entry) bool {
+	h := bloomHash(e.key)
+	c.sketch.increment(h)
+	if _, found := shard.items[e.key]; found || !c.fullFor(shard, e) {
+		return true
+	}
+	victim := c.victimLocked(shard, nil)
+	if victim == nil || c.sketch.estimate(h) > c.sketch.estimate(bloomHash(victim.key)) {
+		return true
+	}
+	c.sketch.rejections.Add(1)
+	return false
+}
+
+// fullFor reports whether storing e as a new item of shard would take the
+// cache or the shard over its limits.
+func (c *Cache) fullFor(shard *cacheShard, e *entry) bool {
+	maxEntries, maxBytes, maxCost := c.maxEntries.Load(), c.maxBytes.Load(), c.maxCost.Load()
+	return maxEntries > 0 && c.count.Load() >= maxEntries ||
+		maxBytes > 0 && c.size.Load()+e.size() > maxBytes ||
+		maxCost > 0 && c.cost.Load()+e.weight() > maxCost ||
+		c.maxShardEntries > 0 && len(shard.items) >= c.maxShardEntries
+}
@@ -0,0 +1,65 @@
+package infux
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestFrequencySketch(t *testing.T) {
+	s := newFrequencySketch(1024)
+	hot, cold := bloomHash("hot"), bloomHash("cold")
+	for i := 0; i < 8; i++ {
+		s.increment(hot)
+	}
+	s.increment(cold)
+	if got := s.estimate(hot); got != 8 {
+		t.Fatalf("estimate(hot) = %d, want 8", got)
+	}
+	if got := s.estimate(cold); got != 1 {
+		t.Fatalf("estimate(cold) = %d, want 1", got)
+	}
+	for i := 0; i < 20; i++ {
+		s.increment(hot)
+	}
+	if got := s.estimate(hot); got != 15 {
+		t.Fatalf("estimate(hot) = %d, want the counters saturated at 15", got)
+	}
+	s.age()
+	if got := s.estimate(hot); got != 7 {
+		t.Fatalf("estimate(hot) = %d after aging, want 7", got)
+	}
+}
+
+// traceHitRatio replays a trace interleaving lookups of keys drawn from a
+// Zipf distribution with a scan of three times as many keys used once,
+// filling the cache on every miss, and returns the hit ratio of the Zipf
+// lookups.
+func traceHitRatio(policy AdmissionPolicy) float64 {
+	c := NewWithConfig(Config{Shards: 4, MaxEntries: 1000, AdmissionPolicy: policy})
+	rng := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(rng, 1.1, 1, 100000)
+	var lookups, hits int
+	for i := 0; i < 200000; i++ {
+		key := fmt.Sprint("scan-", i)
+		if i%4 == 0 {
+			key = fmt.Sprint("zipf-", zipf.Uint64())
+			lookups++
+		}
+		if _, found := c.Get(key); found {
+			if i%4 == 0 {
+				hits++
+			}
+			continue
+		}
+		c.Set(key, []byte("v"))
+	}
+	return float64(hits) / float64(lookups)
+}
+
+func TestTinyLFUResistsScans(t *testing.T) {
+	all, tinyLFU := traceHitRatio(AdmitAll), traceHitRatio(TinyLFU)
+	if tinyLFU < all+0.03 {
+		t.Fatalf("hit ratio %.3f with TinyLFU, %.3f without, want TinyLFU ahead", tinyLFU, all)
+	}
+}
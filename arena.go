@@ -0,0 +1,47 @@
+package infux
+
+import "sync"
+
+// Values stored with Config.Arena are copied into arenaChunkSize chunks,
+// unless they are longer than arenaMaxValue, in which case packing them
+// would waste too much of a chunk and they get their own allocation.
+const (
+	arenaChunkSize = 1 << 20
+	arenaMaxValue  = arenaChunkSize / 16
+)
+
+// arenaChunk is the unused rest of a chunk values are copied into.
+type arenaChunk struct {
+	free []byte
+}
+
+// valueArena packs the values stored in the cache into large chunks, so
+// that the heap holds a few large objects instead of one per value. It is
+// a bump allocator without any bookkeeping: each value is a slice of its
+// chunk, and the garbage collector frees a chunk once no value in it is
+// referenced anymore. Chunks are handed out through a sync.Pool, which
+// keeps one chunk per processor most of the time, so copying needs no
+// lock. A chunk dropped from the pool, for example by a collection, just
+// leaves its unused rest to be freed with it.
+type valueArena struct {
+	chunks sync.Pool
+}
+
+// copy returns a copy of value, preserving nil, in a chunk of a.
+func (a *valueArena) copy(value []byte) []byte {
+	if value == nil || len(value) > arenaMaxValue {
+		return cloneBytes(value)
+	}
+	chunk, _ := a.chunks.Get().(*arenaChunk)
+	if chunk == nil || len(chunk.free) < len(value) {
+		chunk = &arenaChunk{free: make([]byte, arenaChunkSize)}
+	}
+	n := len(value)
+	// Cap the copy at its length, so that appending to it cannot write
+	// over the next value of the chunk.
+	out := chunk.free[:n:n]
+	copy(out, value)
+	chunk.free = chunk.free[n:]
+	a.chunks.Put(chunk)
+	return out
+}
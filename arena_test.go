@@ -0,0 +1,61 @@
+package infux
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func TestArenaCopiesValues(t *testing.T) {
+	c := NewWithConfig(Config{Arena: true})
+	a, b := []byte("first"), []byte("second")
+	c.Set("a", a)
+	c.Set("b", b)
+	c.Set("nil", nil)
+	c.Set("large", make([]byte, arenaMaxValue+1))
+	a[0] = 'X'
+	got, _ := c.Get("a")
+	if string(got) != "first" {
+		t.Fatalf("Get(a) = %q, want the value copied when set", got)
+	}
+	_ = append(got, "-appended"...)
+	if got, _ := c.Get("b"); string(got) != "second" {
+		t.Fatalf("Get(b) = %q after appending to a, want %q", got, "second")
+	}
+	if got, found := c.Get("nil"); !found || got != nil {
+		t.Fatalf("Get(nil) = %q, %v, want a nil value", got, found)
+	}
+	if got, _ := c.Get("large"); len(got) != arenaMaxValue+1 {
+		t.Fatalf("Get(large) has length %d, want %d", len(got), arenaMaxValue+1)
+	}
+}
+
+// BenchmarkArena measures writes of small values and the time a full
+// garbage collection takes once 1<<20 of them are cached, with and
+// without the arena.
+func BenchmarkArena(b *testing.B) {
+	for _, arena := range []bool{false, true} {
+		b.Run(fmt.Sprintf("Arena=%v/Set", arena), func(b *testing.B) {
+			c := NewWithConfig(Config{Arena: arena})
+			value := make([]byte, 64)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.Set(fmt.Sprint(i%(1<<16)), value)
+			}
+		})
+		b.Run(fmt.Sprintf("Arena=%v/GC", arena), func(b *testing.B) {
+			c := NewWithConfig(Config{Arena: arena})
+			value := make([]byte, 64)
+			for i := 0; i < 1<<20; i++ {
+				c.Set(fmt.Sprint(i), value)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+			}
+			b.StopTimer()
+			runtime.KeepAlive(c)
+		})
+	}
+}
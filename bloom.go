@@ -0,0 +1,140 @@
+package infux
+
+import "sync/atomic"
+
+// bloomBitsPerKey and bloomHashes size the bloom filters for a false
+// positive rate of about 1% at their nominal capacity.
+const (
+	bloomBitsPerKey = 10
+	bloomHashes     = 7
+)
+
+// bloomFilter is a bloom filter of the keys written to a shard. Bits are
+// set under the shard's write lock but read without any lock, so they are
+// accessed atomically. Bits are never cleared; a stale filter is replaced
+// as a whole.
+type bloomFilter struct {
+	bits []atomic.Uint64
+	// mask is the number of bits minus one.
+	mask uint64
+}
+
+// newBloomFilter returns an empty filter sized for n keys.
+func newBloomFilter(n int) *bloomFilter {
+	words := 1
+	for words*64 < n*bloomBitsPerKey {
+		words *= 2
+	}
+	return &bloomFilter{bits: make([]atomic.Uint64, words), mask: uint64(words*64 - 1)}
+}
+
+// add records the key with bloom hash h.
+func (f *bloomFilter) add(h uint64) {
+	h1, h2 := h, h>>32|1
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) & f.mask
+		word, mask := &f.bits[bit/64], uint64(1)<<(bit%64)
+		for {
+			old := word.Load()
+			if old&mask != 0 || word.CompareAndSwap(old, old|mask) {
+				break
+			}
+		}
+	}
+}
+
+// mayContain reports whether the key with bloom hash h may have been
+// added. False means it definitely was not.
+func (f *bloomFilter) mayContain(h uint64) bool {
+	h1, h2 := h, h>>32|1
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) & f.mask
+		if f.bits[bit/64].Load()&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// FNV-1a 64-bit parameters, as defined by hash/fnv, used by both the shard
+// hash and bloomHash.
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// bloomHash hashes key for the bloom filters with 64-bit FNV-1a, finished
+// differently from the shard hash so that the keys of one shard still
+// spread over all the bits of its filter.
+func bloomHash(key string) uint64 {
+	h := uint64(fnvOffset64)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= fnvPrime64
+	}
+	// The low bits of FNV-1a mix poorly, so finish with the 64-bit
+	// finalizer of MurmurHash3.
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// newBloomFilterForShard returns an empty filter for one of the n shards
+// of the cache, or nil if the cache has no bloom filters.
+func (c *Cache) newBloomFilterForShard(n int) *bloomFilter {
+	if c.bloomKeys == 0 {
+		return nil
+	}
+	return newBloomFilter((c.bloomKeys + n - 1) / n)
+}
+
+// bloomAddLocked records a key written to shard in its bloom filter. The
+// caller must hold the shard's write lock.
+func (c *Cache) bloomAddLocked(shard *cacheShard, key string) {
+	if f := shard.bloom.Load(); f != nil {
+		f.add(bloomHash(key))
+	}
+}
+
+// bloomMiss reports whether key is definitely absent according to its
+// shard's bloom filter, without locking the shard, and if so records the
+// miss.
+func (c *Cache) bloomMiss(key string) bool {
+	if c.bloomKeys == 0 {
+		return false
+	}
+	shard := c.getShard(key)
+	if f := shard.bloom.Load(); f == nil || f.mayContain(bloomHash(key)) {
+		return false
+	}
+	shard.stats.misses.Add(1)
+	return true
+}
+
+// RebuildBloomFilters replaces the bloom filter of every shard with one
+// holding only the keys of its live items. Deleted, evicted and expired
+// keys stay in the filters until they are rebuilt, which makes them let
+// through more lookups for missing keys, so caches with a lot of churn
+// should call it periodically. Each shard is read-locked while its filter
+// is rebuilt. It does nothing if Config.BloomFilterSize is not set.
+func (c *Cache) RebuildBloomFilters() {
+	if c.bloomKeys == 0 {
+		return
+	}
+	shards := c.table().shards
+	for _, shard := range shards {
+		f := c.newBloomFilterForShard(len(shards))
+		shard.mu.RLock()
+		now := c.now()
+		for key, e := range shard.items {
+			if !e.expired(now) {
+				f.add(bloomHash(key))
+			}
+		}
+		shard.bloom.Store(f)
+		shard.mu.RUnlock()
+	}
+}
@@ -0,0 +1,80 @@
+package infux
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilterFindsEveryAddedKey(t *testing.T) {
+	c := NewWithConfig(Config{BloomFilterSize: 1000})
+	for i := 0; i < 2000; i++ {
+		c.Set(fmt.Sprint(i), []byte("v"))
+	}
+	for i := 0; i < 2000; i++ {
+		if !c.Has(fmt.Sprint(i)) {
+			t.Fatalf("bloom filter rejected key %d, which was set", i)
+		}
+	}
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	const n = 10000
+	f := newBloomFilter(n)
+	for i := 0; i < n; i++ {
+		f.add(bloomHash(fmt.Sprint("in-", i)))
+	}
+	var falsePositives int
+	for i := 0; i < n; i++ {
+		if f.mayContain(bloomHash(fmt.Sprint("out-", i))) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / n; rate > 0.02 {
+		t.Fatalf("false positive rate %.3f at nominal capacity, want about 0.01", rate)
+	}
+}
+
+func TestRebuildBloomFiltersForgetsDeletedKeys(t *testing.T) {
+	c := NewWithConfig(Config{BloomFilterSize: 1000})
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint(i), []byte("v"))
+	}
+	for i := 0; i < 1000; i++ {
+		c.Delete(fmt.Sprint(i))
+	}
+	c.Set("kept", []byte("v"))
+	c.RebuildBloomFilters()
+	var passed int
+	for i := 0; i < 1000; i++ {
+		if !c.bloomMiss(fmt.Sprint(i)) {
+			passed++
+		}
+	}
+	if passed > 50 {
+		t.Fatalf("%d of 1000 deleted keys still pass the rebuilt filters", passed)
+	}
+	if c.bloomMiss("kept") {
+		t.Fatal("rebuilt filters reject a live key")
+	}
+}
+
+func BenchmarkGetMiss(b *testing.B) {
+	for _, size := range []int{0, 100000} {
+		b.Run(fmt.Sprintf("BloomFilterSize=%d", size), func(b *testing.B) {
+			c := NewWithConfig(Config{BloomFilterSize: size})
+			for i := 0; i < 100000; i++ {
+				c.Set(fmt.Sprint("present-", i), []byte("v"))
+			}
+			missing := make([]string, 1024)
+			for i := range missing {
+				missing[i] = fmt.Sprint("missing-", i)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					c.Get(missing[i%len(missing)])
+				}
+			})
+		})
+	}
+}
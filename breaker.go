@@ -0,0 +1,132 @@
+package infux
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is wrapped by the error returned in place of a load while
+// the Loader's circuit breaker is open; see Config.LoaderBreakerThreshold.
+var ErrCircuitOpen = errors.New("infux: loader circuit open")
+
+// Defaults of the Loader's circuit breaker.
+const (
+	DefaultLoaderBreakerWindow   = 10 * time.Second
+	DefaultLoaderBreakerCooldown = 5 * time.Second
+)
+
+// BreakerState is the state of the Loader's circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets loads through. It is also the state of caches
+	// without a breaker.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails loads fast with ErrCircuitOpen until the cooldown
+	// has passed.
+	BreakerOpen
+	// BreakerHalfOpen lets a single probing load through, which closes
+	// the circuit if it succeeds and opens it again if it fails.
+	BreakerHalfOpen
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// loaderBreaker is the circuit breaker in front of the Loader, for
+// Config.LoaderBreakerThreshold. Times are in Unix nanoseconds.
+type loaderBreaker struct {
+	threshold int
+	window    int64
+	cooldown  int64
+
+	mu    sync.Mutex
+	state BreakerState
+	// failures is the number of consecutive failed loads, the first of
+	// which failed at since.
+	failures int
+	since    int64
+	// openedAt is when the circuit last opened.
+	openedAt int64
+	// probing is set while the probing load of the half-open state runs.
+	probing    bool
+	rejections uint64
+}
+
+// allow reports whether a load may call the Loader at now, counting it as
+// rejected if not, and whether the load is the probe of a half-open
+// circuit. An open circuit whose cooldown has passed turns half-open and
+// lets the first load through as its probe.
+func (b *loaderBreaker) allow(now int64) (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && now-b.openedAt >= b.cooldown {
+		b.state = BreakerHalfOpen
+	}
+	switch {
+	case b.state == BreakerClosed:
+		return true, false
+	case b.state == BreakerHalfOpen && !b.probing:
+		b.probing = true
+		return true, true
+	}
+	b.rejections++
+	return false, false
+}
+
+// done records the outcome of a load allowed at now, and reports the
+// state the circuit switched to, if it did.
+func (b *loaderBreaker) done(probe, failed bool, now int64) (BreakerState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+		if failed {
+			b.state, b.openedAt = BreakerOpen, now
+		} else {
+			b.state, b.failures = BreakerClosed, 0
+		}
+		return b.state, true
+	}
+	if b.state != BreakerClosed {
+		// A load allowed before the circuit opened.
+		return b.state, false
+	}
+	switch {
+	case !failed:
+		b.failures = 0
+	case b.failures == 0 || now-b.since > b.window:
+		b.failures, b.since = 1, now
+	default:
+		b.failures++
+	}
+	if b.failures >= b.threshold {
+		b.state, b.openedAt = BreakerOpen, now
+		return b.state, true
+	}
+	return b.state, false
+}
+
+// snapshot returns the state of the circuit at now and the number of
+// rejected loads.
+func (b *loaderBreaker) snapshot(now int64) (BreakerState, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.state
+	if state == BreakerOpen && now-b.openedAt >= b.cooldown {
+		state = BreakerHalfOpen
+	}
+	return state, b.rejections
+}
@@ -0,0 +1,83 @@
+package infux
+
+// Expiry buckets, enabled by Config.BucketedExpiry, let the sweeper find
+// expired items without scanning every item of the cache. Time is cut into
+// windows of Cache.bucketWidth nanoseconds, and every shard files the key
+// of each of its items that can expire in the bucket of the window its
+// deadline falls in. A sweep only visits the buckets of windows that have
+// begun. Records are not removed when an item is deleted, overwritten or
+// given a new expiry; instead, a record is checked when its bucket comes
+// due, and dropped if its key no longer holds an item governed by that
+// bucket, or filed again if the item's deadline moved later.
+
+// scheduleLocked files e, which is stored in shard, in the bucket of its
+// deadline, unless it never expires or a bucket due no later already
+// holds it, in which case that bucket will file it again if needed. The
+// caller must hold the shard's write lock.
+func (c *Cache) scheduleLocked(shard *cacheShard, e *entry) {
+	if c.bucketWidth == 0 {
+		return
+	}
+	at := e.deadline()
+	if at == 0 {
+		return
+	}
+	// A bucket of a window already swept would not be visited again.
+	window := max(at/c.bucketWidth, shard.swept)
+	if e.bucket != 0 && e.bucket-1 <= window {
+		return
+	}
+	if shard.buckets == nil {
+		shard.buckets = make(map[int64][]string)
+	}
+	shard.buckets[window] = append(shard.buckets[window], e.key)
+	e.bucket = window + 1
+}
+
+// sweepBucketsLocked removes the items of shard expired by now from the
+// buckets of the windows that have begun, filing the items whose deadline
+// has moved later in the buckets of their new deadlines, and returns the
+// number of items removed. The bucket of the current window is visited
+// on every sweep until the window ends, so that items expiring within it
+// are removed as promptly as by a full scan. The caller must hold the
+// shard's write lock.
+func (c *Cache) sweepBucketsLocked(shard *cacheShard, now int64) int {
+	current := now / c.bucketWidth
+	var due []int64
+	if current-shard.swept < int64(len(shard.buckets)) {
+		for window := shard.swept; window <= current; window++ {
+			if _, found := shard.buckets[window]; found {
+				due = append(due, window)
+			}
+		}
+	} else {
+		// Fewer buckets than windows to visit, as after a long pause
+		// between sweeps: look at each bucket instead.
+		for window := range shard.buckets {
+			if window <= current {
+				due = append(due, window)
+			}
+		}
+	}
+	shard.swept = current
+	removed := 0
+	for _, window := range due {
+		keys := shard.buckets[window]
+		delete(shard.buckets, window)
+		for _, key := range keys {
+			e, found := shard.items[key]
+			if !found || e.bucket != window+1 {
+				// The item is gone, or filed in an earlier bucket.
+				continue
+			}
+			e.bucket = 0
+			if e.expired(now) {
+				c.evictLocked(shard, e, ReasonExpired)
+				removed++
+				continue
+			}
+			c.scheduleLocked(shard, e)
+		}
+	}
+	return removed
+}
@@ -0,0 +1,78 @@
+package infux
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestBucketedExpiryMatchesFullScan(t *testing.T) {
+	full, fullClock := newTestCache(Config{Shards: 4})
+	bucketed, bucketedClock := newTestCache(Config{Shards: 4, BucketedExpiry: true})
+	rng := rand.New(rand.NewSource(1))
+	for step := 0; step < 200; step++ {
+		for i := 0; i < 50; i++ {
+			key := fmt.Sprint(rng.Intn(2000))
+			ttl := time.Duration(rng.Intn(10000)) * time.Millisecond
+			switch rng.Intn(10) {
+			case 0:
+				full.Delete(key)
+				bucketed.Delete(key)
+			case 1:
+				full.Touch(key, ttl)
+				bucketed.Touch(key, ttl)
+			case 2:
+				full.Set(key, []byte("v"))
+				bucketed.Set(key, []byte("v"))
+			default:
+				full.SetWithTTL(key, []byte("v"), ttl)
+				bucketed.SetWithTTL(key, []byte("v"), ttl)
+			}
+		}
+		advance := time.Duration(rng.Intn(500)) * time.Millisecond
+		fullClock.Advance(advance)
+		bucketedClock.Advance(advance)
+		if got, want := bucketed.DeleteExpired(), full.DeleteExpired(); got != want {
+			t.Fatalf("step %d: bucketed sweep removed %d items, full scan %d", step, got, want)
+		}
+		if got, want := bucketed.Len(), full.Len(); got != want {
+			t.Fatalf("step %d: Len = %d with buckets, %d without", step, got, want)
+		}
+	}
+	for _, key := range full.Keys() {
+		if !bucketed.Has(key) {
+			t.Fatalf("key %q kept by the full scan but not with buckets", key)
+		}
+	}
+}
+
+// BenchmarkSweep measures DeleteExpired on a cache of 1<<20 items, of
+// which 100 expire between sweeps, scanning every item and with
+// bucketed expiry.
+func BenchmarkSweep(b *testing.B) {
+	for _, bucketed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("BucketedExpiry=%v", bucketed), func(b *testing.B) {
+			c, clk := newTestCache(Config{BucketedExpiry: bucketed})
+			for i := 0; i < 1<<20; i++ {
+				c.Set(fmt.Sprint(i), []byte("v"))
+			}
+			keys := make([]string, 100)
+			for i := range keys {
+				keys[i] = fmt.Sprint("expiring-", i)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				for _, key := range keys {
+					c.SetWithTTL(key, []byte("v"), time.Second)
+				}
+				clk.Advance(time.Second)
+				b.StartTimer()
+				if removed := c.DeleteExpired(); removed != len(keys) {
+					b.Fatalf("DeleteExpired removed %d items, want %d", removed, len(keys))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package infux
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// guard runs fn, which calls the user callback named callback, and
+// reports whether it returned normally. A panic in the callback is
+// recovered and logged to Config.Logger, so that it cannot kill a
+// background goroutine of the cache, or unwind through code that holds
+// its locks.
+func (c *Cache) guard(callback string, fn func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Error("infux: callback panicked",
+				"callback", callback, "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+	fn()
+	return true
+}
+
+// callLoader loads key through the Loader, turning a panic of the Loader
+// into an error wrapping ErrPanicked. With a circuit breaker, it fails
+// fast with an error wrapping ErrCircuitOpen while the circuit is open,
+// and otherwise records whether the load failed; ErrNotFound is a
+// successful answer of the backing store, not a failure. Failed loads
+// and the circuit opening or closing are logged to Config.Logger.
+func (c *Cache) callLoader(key string) (value []byte, err error) {
+	if c.breaker != nil {
+		ok, probe := c.breaker.allow(c.now())
+		if !ok {
+			return nil, fmt.Errorf("%w: Loader for key %q", ErrCircuitOpen, key)
+		}
+		defer func() {
+			state, changed := c.breaker.done(probe, err != nil && !errors.Is(err, ErrNotFound), c.now())
+			switch {
+			case !changed:
+			case state == BreakerOpen:
+				c.logger.Warn("infux: Loader circuit breaker opened", "cooldown", time.Duration(c.breaker.cooldown))
+			default:
+				c.logger.Info("infux: Loader circuit breaker closed")
+			}
+		}()
+	}
+	if !c.guard("Loader", func() { value, err = c.loader(key) }) {
+		return nil, fmt.Errorf("%w: Loader for key %q", ErrPanicked, key)
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		c.logger.Warn("infux: Loader failed", "key", key, "err", err)
+	}
+	return value, err
+}
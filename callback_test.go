@@ -0,0 +1,65 @@
+package infux
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPanickingOnEvictLeavesCacheUsable(t *testing.T) {
+	var logged bytes.Buffer
+	var evictions atomic.Int32
+	c := NewWithConfig(Config{
+		Shards:          1,
+		MaxEntries:      2,
+		CleanupInterval: time.Millisecond,
+		Logger:          slog.New(slog.NewTextHandler(&logged, nil)),
+		OnEvict: func(key string, value []byte, reason EvictReason) {
+			evictions.Add(1)
+			panic("boom")
+		},
+	})
+	defer c.Close()
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+	c.Set("c", []byte("3"))
+	c.Set("b", []byte("overwritten"))
+	if n := evictions.Load(); n != 2 {
+		t.Fatalf("OnEvict called %d times, want 2", n)
+	}
+	// The shard must not have been left locked.
+	c.Set("d", []byte("4"))
+	if v, found := c.Get("d"); !found || string(v) != "4" {
+		t.Fatalf("Get = %q, %v after OnEvict panicked", v, found)
+	}
+	if c.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", c.Len())
+	}
+	if !strings.Contains(logged.String(), "callback panicked") || !strings.Contains(logged.String(), "OnEvict") {
+		t.Fatalf("panic not logged, log:\n%s", logged.String())
+	}
+
+	// The sweeper survives a panic in OnEvict and keeps sweeping.
+	c.SetWithTTL("short", []byte("v"), time.Millisecond)
+	waitFor(t, func() bool { return c.Stats().Expirations == 1 })
+	c.SetWithTTL("later", []byte("v"), time.Millisecond)
+	waitFor(t, func() bool { return c.Stats().Expirations == 2 })
+}
+
+func TestPanickingLoaderReturnsError(t *testing.T) {
+	c := NewWithConfig(Config{
+		Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)),
+		Loader: func(key string) ([]byte, error) { panic("boom") },
+	})
+	if _, err := c.GetErr("k"); !errors.Is(err, ErrPanicked) {
+		t.Fatalf("GetErr = %v, want ErrPanicked", err)
+	}
+	c.Set("k", []byte("v"))
+	if v, _ := c.Get("k"); string(v) != "v" {
+		t.Fatalf("Get = %q after the Loader panicked", v)
+	}
+}
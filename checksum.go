@@ -0,0 +1,22 @@
+package infux
+
+import "hash/crc32"
+
+// checksumTable is the CRC-32C table used for Config.VerifyChecksums,
+// which is computed with dedicated instructions on most CPUs.
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum returns the checksum of a stored value.
+func checksum(value []byte) uint32 {
+	return crc32.Checksum(value, checksumTable)
+}
+
+// intact reports whether the value of e still matches its checksum,
+// logging the corruption to Config.Logger if not.
+func (c *Cache) intact(e *entry) bool {
+	if checksum(e.value) == e.sum {
+		return true
+	}
+	c.logger.Error("infux: value does not match its checksum", "key", e.key)
+	return false
+}
@@ -0,0 +1,133 @@
+package infux
+
+import (
+	"sync"
+	"time"
+)
+
+// EvictionStats describes how well the cache's limits fit its working
+// set, as returned by EvictionStats.
+type EvictionStats struct {
+	// Evictions is the number of items removed to keep the cache within
+	// its limits, as in Stats.
+	Evictions uint64
+	// FillRatio is how full the cache is by the limit closest to being
+	// reached, the largest of the entry count over MaxEntries, SizeBytes
+	// over MaxBytes and the total cost over MaxCost, or 0 if the cache
+	// has no limits.
+	FillRatio float64
+
+	// Rate is the recent number of evictions per second, measured over
+	// the evictions remembered by Config.TrackEvictionChurn.
+	Rate float64
+	// Reinserted is the number of evicted keys that were written again
+	// while still remembered. A high Reinserted relative to Evictions
+	// means items are evicted only to be loaded again shortly after: the
+	// cache is too small for its working set.
+	//
+	// Rate and Reinserted are only set with Config.TrackEvictionChurn,
+	// and count from when the cache was created or last cleared.
+	Reinserted uint64
+}
+
+// churnTracker remembers the most recently evicted keys, to count the
+// ones written again soon after being evicted.
+type churnTracker struct {
+	mu sync.Mutex
+	// ring holds the latest evictions, the oldest at next once full.
+	ring []churnEviction
+	next int
+	// recent maps each remembered key that has not been written since to
+	// its latest position in ring.
+	recent     map[string]int
+	reinserted uint64
+}
+
+// churnEviction is an eviction remembered by a churnTracker.
+type churnEviction struct {
+	key string
+	// at is the time of the eviction, in Unix nanoseconds, or 0 if the
+	// slot is unused.
+	at int64
+}
+
+// newChurnTracker returns a tracker remembering up to capacity evictions.
+func newChurnTracker(capacity int) *churnTracker {
+	return &churnTracker{
+		ring:   make([]churnEviction, capacity),
+		recent: make(map[string]int, capacity),
+	}
+}
+
+// evicted records the eviction of key at now, forgetting the oldest
+// eviction remembered if the tracker is full.
+func (t *churnTracker) evicted(key string, now int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	old := t.ring[t.next]
+	if pos, ok := t.recent[old.key]; ok && pos == t.next {
+		delete(t.recent, old.key)
+	}
+	t.ring[t.next] = churnEviction{key: key, at: now}
+	t.recent[key] = t.next
+	t.next = (t.next + 1) % len(t.ring)
+}
+
+// stored records a write of a new item under key, counting it as a
+// reinsertion if key was evicted recently.
+func (t *churnTracker) stored(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.recent[key]; ok {
+		delete(t.recent, key)
+		t.reinserted++
+	}
+}
+
+// rate returns the number of evictions per second from the oldest
+// eviction remembered until now.
+func (t *churnTracker) rate(now int64) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	oldest, n := t.ring[t.next].at, len(t.ring)
+	if oldest == 0 {
+		// The ring is not full yet, so it starts at the first slot.
+		oldest, n = t.ring[0].at, t.next
+	}
+	if n == 0 || now <= oldest {
+		return 0
+	}
+	return float64(n) / time.Duration(now-oldest).Seconds()
+}
+
+// reset forgets all evictions and reinsertions.
+func (t *churnTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.ring)
+	clear(t.recent)
+	t.next = 0
+	t.reinserted = 0
+}
+
+// EvictionStats returns diagnostics of the cache's evictions, to tell
+// whether its limits are too small for its working set. Rate and
+// Reinserted require Config.TrackEvictionChurn.
+func (c *Cache) EvictionStats() EvictionStats {
+	s := EvictionStats{Evictions: c.Stats().Evictions}
+	ratio := func(n, limit int64) {
+		if limit > 0 {
+			s.FillRatio = max(s.FillRatio, float64(n)/float64(limit))
+		}
+	}
+	ratio(c.count.Load(), c.maxEntries.Load())
+	ratio(c.SizeBytes(), c.maxBytes.Load())
+	ratio(c.cost.Load(), c.maxCost.Load())
+	if c.churn != nil {
+		s.Rate = c.churn.rate(c.now())
+		c.churn.mu.Lock()
+		s.Reinserted = c.churn.reinserted
+		c.churn.mu.Unlock()
+	}
+	return s
+}
@@ -0,0 +1,23 @@
+package infux
+
+import "time"
+
+// clock tells the time used to compute and check expiry times. Caches use
+// realClock; tests can substitute a fakeClock to move time forward
+// deterministically instead of sleeping.
+type clock interface {
+	Now() time.Time
+}
+
+// realClock is the wall clock.
+type realClock struct{}
+
+// Now returns the current time.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// now returns the current time of the cache's clock in Unix nanoseconds.
+func (c *Cache) now() int64 {
+	return c.clock.Now().UnixNano()
+}
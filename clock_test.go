@@ -0,0 +1,107 @@
+package infux
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for tests.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// newFakeClock returns a fakeClock set to now.
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+// Now returns the clock's current time.
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the clock forward by d.
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// newTestCache returns a cache configured by cfg whose clock is a
+// fakeClock, also returned, starting at an arbitrary time.
+func newTestCache(cfg Config) (*Cache, *fakeClock) {
+	clk := newFakeClock(time.Unix(1000, 0))
+	return newWithConfig(cfg, clk), clk
+}
+
+func TestTTLExpiresOnFakeClock(t *testing.T) {
+	c, clk := newTestCache(Config{})
+	c.SetWithTTL("k", []byte("v"), time.Minute)
+	clk.Advance(time.Minute - 1)
+	if !c.Has("k") {
+		t.Fatal("item expired before its TTL")
+	}
+	clk.Advance(1)
+	if _, found := c.Get("k"); found {
+		t.Fatal("item live once its TTL elapsed")
+	}
+}
+
+func TestTouchExtendsExpiry(t *testing.T) {
+	c, clk := newTestCache(Config{})
+	c.SetWithTTL("k", []byte("v"), time.Minute)
+	clk.Advance(50 * time.Second)
+	c.Touch("k", time.Minute)
+	clk.Advance(50 * time.Second)
+	if !c.Has("k") {
+		t.Fatal("touched item expired at its original deadline")
+	}
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	c, clk := newTestCache(Config{SlidingExpiration: true})
+	c.SetWithTTL("k", []byte("v"), time.Minute)
+	for i := 0; i < 5; i++ {
+		clk.Advance(50 * time.Second)
+		if _, found := c.Get("k"); !found {
+			t.Fatalf("item read every 50s expired after %d reads", i)
+		}
+	}
+	clk.Advance(time.Minute)
+	if c.Has("k") {
+		t.Fatal("item live a TTL after its last read")
+	}
+}
+
+func TestMaxIdle(t *testing.T) {
+	c, clk := newTestCache(Config{})
+	c.SetWithMaxIdle("k", []byte("v"), time.Minute)
+	clk.Advance(50 * time.Second)
+	c.Get("k")
+	clk.Advance(50 * time.Second)
+	if !c.Has("k") {
+		t.Fatal("item used 50s ago expired")
+	}
+	clk.Advance(time.Minute)
+	if c.Has("k") {
+		t.Fatal("item idle for over a minute is live")
+	}
+}
+
+func TestDeleteExpiredOnFakeClock(t *testing.T) {
+	c, clk := newTestCache(Config{})
+	c.SetWithTTL("a", []byte("v"), time.Second)
+	c.SetWithTTL("b", []byte("v"), time.Hour)
+	c.Set("c", []byte("v"))
+	clk.Advance(time.Minute)
+	if n := c.DeleteExpired(); n != 1 {
+		t.Fatalf("DeleteExpired removed %d items, want 1", n)
+	}
+	if c.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", c.Len())
+	}
+}
@@ -0,0 +1,66 @@
+package infux
+
+// Clone returns an independent deep copy of the cache. The clone has
+// the same configuration, including limits and callbacks but not
+// Config.Persist, and receives copies of all live items with their
+// expiry times; values are copied rather than shared, so later writes
+// to either cache, or to the returned value slices, do not affect the
+// other. Statistics start at zero.
+//
+// Each source shard is read-locked only while it is copied, so Clone is a
+// point-in-time snapshot per shard: writes made concurrently with Clone
+// may be reflected in some shards and not in others. Like any cache
+// created with NewWithConfig, the clone starts its own background sweeper
+// if one is configured and should then be closed when no longer needed.
+func (c *Cache) Clone() *Cache {
+	table := c.table()
+	cfg := c.cfg
+	cfg.Shards = len(table.shards)
+	// The snapshot file belongs to the original cache.
+	cfg.Persist = PersistConfig{}
+	clone := newWithConfig(cfg, c.clock)
+	for i, shard := range table.shards {
+		c.cloneShard(shard, clone, clone.table().shards[i])
+	}
+	return clone
+}
+
+// cloneShard copies the live items of shard into dst, a shard of clone
+// with the same index. Items are copied from least to most recently used,
+// so that the clone's LRU order matches the source.
+func (c *Cache) cloneShard(shard *cacheShard, clone *Cache, dst *cacheShard) {
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	dst.mu.Lock()
+	defer clone.unlock(dst)
+	now := c.now()
+	copyEntry := func(e *entry) {
+		if e.expired(now) {
+			return
+		}
+		n := &entry{
+			key:        e.key,
+			value:      cloneBytes(e.value),
+			compressed: e.compressed,
+			cost:       e.cost,
+			tags:       e.tags,
+			expiresAt:  e.expiresAt,
+			ttl:        e.ttl,
+			maxIdle:    e.maxIdle,
+		}
+		n.usedAt.Store(e.usedAt.Load())
+		n.freq.Store(e.freq.Load())
+		clone.storeLocked(dst, n)
+		n.writtenAt = e.writtenAt
+		n.atime.Store(e.atime.Load())
+	}
+	if c.ordered {
+		for e := shard.lru.back(); e != nil && e != &shard.lru.root; e = e.prev {
+			copyEntry(e)
+		}
+		return
+	}
+	for _, e := range shard.items {
+		copyEntry(e)
+	}
+}
@@ -0,0 +1,33 @@
+package infux
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCloneIsIndependent(t *testing.T) {
+	c := New()
+	c.Set("a", []byte("1"))
+	c.SetWithTTL("b", []byte("2"), time.Hour)
+	clone := c.Clone()
+	c.Set("a", []byte("changed"))
+	clone.Delete("b")
+	if v, _ := clone.Get("a"); string(v) != "1" {
+		t.Fatalf("clone.Get(a) = %q, want 1", v)
+	}
+	if !c.Has("b") {
+		t.Fatal("deleting from the clone removed the original's item")
+	}
+}
+
+func TestCloneSharesClockWithSweeper(t *testing.T) {
+	c, clk := newTestCache(Config{CleanupInterval: time.Millisecond})
+	defer c.Close()
+	c.SetWithTTL("k", []byte("v"), time.Second)
+	// Under the race detector, this checks that the clone's sweeper does
+	// not read its clock before Clone sets it.
+	clone := c.Clone()
+	defer clone.Close()
+	clk.Advance(2 * time.Second)
+	waitFor(t, func() bool { return clone.Len() == 0 })
+}
@@ -0,0 +1,63 @@
+package infux
+
+const (
+	// compactMinPeak is the number of items a shard must have held for
+	// the sweeper to consider compacting it, as smaller maps waste too
+	// little memory to be worth rebuilding.
+	compactMinPeak = 1024
+	// compactRatio is the factor by which a shard's item count must have
+	// fallen below its peak for the sweeper to compact it.
+	compactRatio = 4
+)
+
+// Compact rebuilds the map of every shard that holds fewer items than it
+// once did, to release the memory of the rest. Go maps never shrink:
+// deleting items frees their entries but not the buckets that held them,
+// so a shard that once held a million items keeps the memory for them
+// after most are gone. The standard remedy, applied here, is to rehash
+// the remaining items into a fresh map sized for them and let the old one
+// be garbage collected. Each shard is write-locked while its map is
+// rebuilt, which takes time proportional to its item count, so Compact
+// suits quiet periods or an occasional call after a mass deletion; with
+// Config.CompactMaps, the background sweeper compacts only the shards
+// that have shrunk the most. Maps preallocated by Config.InitialCapacity
+// are not shrunk below that size. Compact is a no-op on a closed cache.
+func (c *Cache) Compact() {
+	c.compact(1, 0)
+}
+
+// compact rebuilds the map of every shard that has held more than
+// minPeak items and now holds fewer than its peak divided by ratio.
+func (c *Cache) compact(ratio, minPeak int) {
+	if c.closed.Load() {
+		return
+	}
+	for _, shard := range c.table().shards {
+		shard.mu.Lock()
+		if !shard.moved && shard.peak > max(c.shardCapacity, minPeak) && len(shard.items)*ratio < shard.peak {
+			c.logger.Debug("infux: compacted shard map", "items", len(shard.items), "peak", shard.peak)
+			compactLocked(shard, max(len(shard.items), c.shardCapacity))
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// compactLocked replaces the map of shard with a copy allocated for
+// capacity items. The caller must hold the shard's write lock.
+func compactLocked(shard *cacheShard, capacity int) {
+	items := make(map[string]*entry, capacity)
+	for key, e := range shard.items {
+		items[key] = e
+	}
+	shard.items = items
+	shard.peak = len(items)
+}
+
+// compactSparse compacts the shards of a cache with Config.CompactMaps
+// whose maps have shrunk to a small fraction of their peak. It is run by
+// the background sweeper.
+func (c *Cache) compactSparse() {
+	if c.compactMaps {
+		c.compact(compactRatio, compactMinPeak)
+	}
+}
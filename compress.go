@@ -0,0 +1,161 @@
+package infux
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compressor compresses values stored in the cache. See
+// Config.Compressor.
+type Compressor interface {
+	// Compress returns a compressed copy of src. If it returns an error,
+	// the value is stored uncompressed.
+	Compress(src []byte) ([]byte, error)
+	// Decompress returns the value that was compressed into src. It must
+	// succeed for any output of Compress.
+	Decompress(src []byte) ([]byte, error)
+}
+
+// minCompressSize is the length below which values are stored without
+// attempting to compress them, as the saving cannot pay for the CPU time.
+const minCompressSize = 64
+
+// GzipCompressor is a Compressor that uses gzip at a fixed compression
+// level. It is safe for concurrent use.
+type GzipCompressor struct {
+	level   int
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// NewGzipCompressor returns a GzipCompressor that compresses at level,
+// which is one of the compress/gzip levels such as gzip.BestSpeed or
+// gzip.DefaultCompression. It panics if level is invalid.
+func NewGzipCompressor(level int) *GzipCompressor {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		panic(fmt.Sprintf("infux: invalid gzip level %d", level))
+	}
+	return &GzipCompressor{level: level}
+}
+
+// Compress implements Compressor.
+func (g *GzipCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, ok := g.writers.Get().(*gzip.Writer)
+	if ok {
+		zw.Reset(&buf)
+	} else {
+		zw, _ = gzip.NewWriterLevel(&buf, g.level)
+	}
+	defer g.writers.Put(zw)
+	if _, err := zw.Write(src); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress implements Compressor.
+func (g *GzipCompressor) Decompress(src []byte) ([]byte, error) {
+	zr, ok := g.readers.Get().(*gzip.Reader)
+	if ok {
+		if err := zr.Reset(bytes.NewReader(src)); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if zr, err = gzip.NewReader(bytes.NewReader(src)); err != nil {
+			return nil, err
+		}
+	}
+	defer g.readers.Put(zr)
+	return io.ReadAll(zr)
+}
+
+// newEntry returns an entry holding value, which was passed in by the
+// caller, compressed if that pays off and otherwise as copyIn returns it.
+func (c *Cache) newEntry(key string, value []byte) *entry {
+	if packed, ok := c.compress(value); ok {
+		return &entry{key: key, value: packed, compressed: true}
+	}
+	if c.pooled && value != nil {
+		if pool, copied := newPooledValue(value); pool != nil {
+			return &entry{key: key, value: copied, pool: pool}
+		}
+	}
+	return &entry{key: key, value: c.copyIn(value)}
+}
+
+// encode compresses the value of e, an entry built by the cache itself,
+// if that pays off. It returns e.
+func (c *Cache) encode(e *entry) *entry {
+	if packed, ok := c.compress(e.value); ok {
+		e.value, e.compressed = packed, true
+	}
+	return e
+}
+
+// compress returns the compressed form of value, and false if the value
+// should be stored as is because compression is disabled, the value is
+// too small, or compressing does not make it smaller.
+func (c *Cache) compress(value []byte) ([]byte, bool) {
+	if c.compressor == nil || len(value) < minCompressSize {
+		return nil, false
+	}
+	packed, err := c.compressor.Compress(value)
+	if err != nil || len(packed) >= len(value) {
+		return nil, false
+	}
+	return packed, true
+}
+
+// valueOf returns the uncompressed value of e. The result must not be
+// modified, as it may be the stored slice.
+func (c *Cache) valueOf(e *entry) []byte {
+	return c.decode(e.value, e.compressed)
+}
+
+// valueLent returns the value of e to pass to a callback of the caller
+// run under the shard's lock, which may keep it: the stored value itself,
+// or a copy if it is in a pooled buffer, which may be recycled once the
+// lock is released.
+func (c *Cache) valueLent(e *entry) []byte {
+	if e.pool != nil {
+		return cloneBytes(e.value)
+	}
+	return c.valueOf(e)
+}
+
+// valueOut returns the value of e to hand out to the caller. A value that
+// had to be decompressed is already a fresh copy, and a pooled value is
+// always copied, so the caller must hold the shard's lock unless e is
+// pinned.
+func (c *Cache) valueOut(e *entry) []byte {
+	if e.compressed {
+		return c.decode(e.value, true)
+	}
+	if e.pool != nil {
+		// The buffer may be recycled once the lock is released.
+		return cloneBytes(e.value)
+	}
+	return c.copyOut(e.value)
+}
+
+// decode returns the uncompressed form of a stored value. A stored value
+// that fails to decompress means the Compressor is broken, so decode
+// panics rather than returning corrupt data.
+func (c *Cache) decode(value []byte, compressed bool) []byte {
+	if !compressed {
+		return value
+	}
+	plain, err := c.compressor.Decompress(value)
+	if err != nil {
+		panic("infux: decompressing cached value: " + err.Error())
+	}
+	return plain
+}
@@ -0,0 +1,384 @@
+package infux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+)
+
+// GetOrSet returns the existing value for key if it is present.
+// Otherwise, it stores value and returns it. The bool result is true if
+// the value was already present. The check and the write happen under a
+// single shard lock, so concurrent callers never both store a value.
+// On a closed cache, GetOrSet stores nothing and returns value and false.
+func (c *Cache) GetOrSet(key string, value []byte) ([]byte, bool) {
+	key = c.normalize(key)
+	if c.closed.Load() {
+		return value, false
+	}
+	shard := c.lockShard(key)
+	if e, found := c.lookupLocked(shard, key, true); found {
+		value := c.valueOut(e)
+		c.unlock(shard)
+		return value, true
+	}
+	if c.frozen.Load() {
+		c.unlock(shard)
+		return value, false
+	}
+	c.insertLocked(shard, c.newEntry(key, value))
+	c.unlock(shard)
+	c.evictOverflow(shard)
+	return value, false
+}
+
+// GetOrCompute returns the value for key, computing it with fn on a miss.
+// Concurrent calls for the same missing key run fn only once: the other
+// callers wait for it and receive the same result. On success the
+// computed value is stored without expiry. Errors from fn are returned
+// to every waiting caller and are not cached, so a later call runs fn
+// again. If fn returns ErrNotFound and Config.NegativeTTL is set, the
+// miss itself is cached: until it expires, GetOrCompute returns
+// ErrNotFound without calling fn. On a closed cache, GetOrCompute returns
+// ErrClosed.
+func (c *Cache) GetOrCompute(key string, fn func() ([]byte, error)) ([]byte, error) {
+	key = c.normalize(key)
+	if c.closed.Load() {
+		return nil, ErrClosed
+	}
+	if e, found := c.get(key); found {
+		return c.valueOut(e), nil
+	}
+	value, err, _ := c.compute(context.Background(), key, fn)
+	return c.copyOut(value), err
+}
+
+// GetContext returns the value for key, computing it with fn on a miss,
+// like GetOrCompute, but honors ctx while blocked. If another goroutine
+// is already computing or loading the key, GetContext waits for its
+// result and returns ctx.Err() as soon as ctx is done. If that other
+// computation fails only because its own context was cancelled, and ctx
+// is still live, GetContext retries the computation itself.
+//
+// fn is passed ctx and should return promptly once it is done. If fn is
+// nil, the configured Loader is used instead, and a miss with no Loader
+// returns ErrNotFound. On a closed cache, GetContext returns ErrClosed.
+func (c *Cache) GetContext(ctx context.Context, key string, fn func(context.Context) ([]byte, error)) ([]byte, error) {
+	key = c.normalize(key)
+	if c.closed.Load() {
+		return nil, ErrClosed
+	}
+	if e, found := c.get(key); found {
+		return c.valueOut(e), nil
+	}
+	if fn == nil {
+		if c.loader == nil {
+			return nil, ErrNotFound
+		}
+		fn = func(context.Context) ([]byte, error) { return c.callLoader(key) }
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		value, err, shared := c.compute(ctx, key, func() ([]byte, error) {
+			return fn(ctx)
+		})
+		if shared && ctx.Err() == nil &&
+			(errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+			continue
+		}
+		return c.copyOut(value), err
+	}
+}
+
+// compute runs fn to produce the value of a missing key and stores it,
+// coalescing concurrent computations of the same key. Waiting for another
+// caller's computation stops early if ctx is done. shared reports whether
+// the result came from another caller's computation.
+func (c *Cache) compute(ctx context.Context, key string, fn func() ([]byte, error)) ([]byte, error, bool) {
+	shard := c.getShard(key)
+	if c.knownMissing(shard, key) {
+		return nil, ErrNotFound, false
+	}
+	return shard.flight.do(ctx, key, func() ([]byte, error) {
+		// A computation that finished just before this one started may
+		// already have stored the value.
+		if value, found := c.peek(key); found {
+			return value, nil
+		}
+		value, err := fn()
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				c.rememberMissing(shard, key)
+			}
+			return nil, err
+		}
+		c.Set(key, value)
+		return value, nil
+	})
+}
+
+// SetNX stores value under key only if the key is not already present,
+// and reports whether it did. An expired item counts as absent. The check
+// and the write happen under a single shard lock. SetNX returns false on
+// a closed cache.
+func (c *Cache) SetNX(key string, value []byte) bool {
+	key = c.normalize(key)
+	return c.add(c.newEntry(key, value)) == nil
+}
+
+// SetNXWithTTL is like SetNX, but the stored item expires after ttl.
+// Together with Delete or expiry, it can be used to build lease-style
+// locks. A zero or negative ttl means the item never expires.
+func (c *Cache) SetNXWithTTL(key string, value []byte, ttl time.Duration) bool {
+	key = c.normalize(key)
+	return c.add(c.newTTLEntry(key, value, ttl)) == nil
+}
+
+// Add is like SetNX, but reports the outcome as an error, for flows where
+// a duplicate is a failure, such as an idempotency-key store: it returns
+// nil if it stored the item, ErrKeyExists if the key is present, leaving
+// the existing item and its expiry untouched, ErrNotStored if the cache
+// declined to store the item, as Set may, and ErrClosed or ErrFrozen if
+// the cache does not accept writes. The item never expires.
+func (c *Cache) Add(key string, value []byte) error {
+	key = c.normalize(key)
+	return c.add(c.newEntry(key, value))
+}
+
+// AddWithTTL is like Add, but the stored item expires after ttl. A zero
+// or negative ttl means the item never expires.
+func (c *Cache) AddWithTTL(key string, value []byte, ttl time.Duration) error {
+	key = c.normalize(key)
+	return c.add(c.newTTLEntry(key, value, ttl))
+}
+
+// add stores e only if its key is not already present.
+func (c *Cache) add(e *entry) error {
+	if err := c.writeErr(); err != nil {
+		return err
+	}
+	shard := c.lockShard(e.key)
+	if _, found := c.liveLocked(shard, e.key); found {
+		c.unlock(shard)
+		return ErrKeyExists
+	}
+	stored := c.insertLocked(shard, e)
+	c.unlock(shard)
+	c.evictOverflow(shard)
+	if !stored {
+		return ErrNotStored
+	}
+	return nil
+}
+
+// Replace stores value under key only if the key is already present, and
+// reports whether it did. It never creates a key, so it cannot resurrect
+// an item that was deleted or has expired. The item keeps its existing
+// expiry time. The check and the write happen under a single shard lock.
+// Replace returns false on a closed cache.
+func (c *Cache) Replace(key string, value []byte) bool {
+	key = c.normalize(key)
+	if c.writeErr() != nil {
+		return false
+	}
+	shard := c.lockShard(key)
+	old, found := c.liveLocked(shard, key)
+	if !found {
+		c.unlock(shard)
+		return false
+	}
+	stored := c.insertLocked(shard, c.newEntry(key, value).keepExpiry(old))
+	c.unlock(shard)
+	c.evictOverflow(shard)
+	return stored
+}
+
+// CompareAndSwap stores new under key only if the key is present and its
+// current value is byte-for-byte equal to old, and reports whether it did.
+// The item keeps its existing expiry time. The comparison and the write
+// happen under a single shard lock. CompareAndSwap returns false on a
+// closed cache.
+func (c *Cache) CompareAndSwap(key string, old, new []byte) bool {
+	key = c.normalize(key)
+	if c.writeErr() != nil {
+		return false
+	}
+	shard := c.lockShard(key)
+	e, found := c.liveLocked(shard, key)
+	if !found || !bytes.Equal(c.valueOf(e), old) {
+		c.unlock(shard)
+		return false
+	}
+	stored := c.insertLocked(shard, c.newEntry(key, new).keepExpiry(e))
+	c.unlock(shard)
+	c.evictOverflow(shard)
+	return stored
+}
+
+// CompareAndDelete removes key only if it is present and its current
+// value is byte-for-byte equal to old, and reports whether it did. The
+// comparison and the removal happen under a single shard lock.
+// CompareAndDelete returns false on a closed cache.
+func (c *Cache) CompareAndDelete(key string, old []byte) bool {
+	key = c.normalize(key)
+	if c.writeErr() != nil {
+		return false
+	}
+	shard := c.lockShard(key)
+	defer c.unlock(shard)
+	e, found := c.liveLocked(shard, key)
+	if !found || !bytes.Equal(c.valueOf(e), old) {
+		return false
+	}
+	c.deleteLocked(shard, e)
+	return true
+}
+
+// Append appends data to the value stored under key, creating the key if
+// it is absent, and returns the new length of the value. An existing
+// expiry is kept. The read and the write happen under a single shard
+// lock, so concurrent appenders never lose each other's data. Because
+// stored values are never modified in place, each call copies the whole
+// value; values grown by many small appends cost time quadratic in their
+// final length. Append returns 0 on a closed cache.
+func (c *Cache) Append(key string, data []byte) int {
+	n, _ := c.AppendWithLimit(key, data, 0)
+	return n
+}
+
+// AppendWithLimit is like Append, but refuses to grow the value beyond
+// limit bytes. If the result would be longer than limit, the value is left
+// unchanged and ErrTooLarge is returned along with its current length. A
+// zero or negative limit means no limit. ErrTooLarge is also returned if
+// the cache's own limits, such as Config.MaxValueBytes, reject the
+// result. On a closed cache it returns ErrClosed.
+func (c *Cache) AppendWithLimit(key string, data []byte, limit int) (int, error) {
+	key = c.normalize(key)
+	if err := c.writeErr(); err != nil {
+		return 0, err
+	}
+	shard := c.lockShard(key)
+	next := &entry{key: key}
+	var old []byte
+	if e, found := c.liveLocked(shard, key); found {
+		old = c.valueOf(e)
+		next.keepExpiry(e)
+	}
+	if limit > 0 && len(old)+len(data) > limit {
+		c.unlock(shard)
+		return len(old), ErrTooLarge
+	}
+	next.value = append(append(make([]byte, 0, len(old)+len(data)), old...), data...)
+	n := len(next.value)
+	stored := c.insertLocked(shard, c.encode(next))
+	c.unlock(shard)
+	c.evictOverflow(shard)
+	if !stored {
+		return len(old), ErrTooLarge
+	}
+	return n, nil
+}
+
+// Update atomically replaces the value stored under key with the result
+// of fn. fn receives the current value, or nil and false if the key is
+// absent or expired, and returns the new value along with whether to
+// store it. If store is false the item is left unchanged; if it is true
+// and new is nil, the item is deleted, so use an empty non-nil slice to
+// store an empty value. A stored value keeps the item's existing expiry.
+// fn must not modify old, but may retain it.
+//
+// fn runs while Update holds the shard's write lock, so it must be fast,
+// and it must not use the cache, which would deadlock. Update returns
+// ErrTooLarge if the cache's limits reject the new value, as TrySet does,
+// and ErrClosed on a closed cache, in which case fn is not called. If fn
+// panics, the lock is released and the item left unchanged before the
+// panic propagates.
+func (c *Cache) Update(key string, fn func(old []byte, found bool) (new []byte, store bool)) error {
+	key = c.normalize(key)
+	if err := c.writeErr(); err != nil {
+		return err
+	}
+	shard := c.lockShard(key)
+	stored := c.update(shard, key, fn)
+	c.evictOverflow(shard)
+	if !stored {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// update implements Update on shard, which the caller has locked, and
+// unlocks it. It reports false if the limits rejected the new value.
+func (c *Cache) update(shard *cacheShard, key string, fn func([]byte, bool) ([]byte, bool)) bool {
+	defer c.unlock(shard)
+	var old []byte
+	e, found := c.liveLocked(shard, key)
+	if found {
+		old = c.valueLent(e)
+	}
+	value, store := fn(old, found)
+	if !store {
+		return true
+	}
+	if value == nil {
+		if found {
+			c.deleteLocked(shard, e)
+		}
+		return true
+	}
+	next := c.newEntry(key, value)
+	if found {
+		next.keepExpiry(e)
+	}
+	return c.insertLocked(shard, next)
+}
+
+// GetAndSet stores value under key, replacing any existing item, and
+// returns the value it replaced along with whether there was one. Like
+// Set, the stored item never expires. The read and the write happen under
+// a single shard lock, so no other write can slip in between. On a closed
+// cache, GetAndSet stores nothing and returns nil and false.
+func (c *Cache) GetAndSet(key string, value []byte) ([]byte, bool) {
+	key = c.normalize(key)
+	if c.writeErr() != nil {
+		return nil, false
+	}
+	e := c.newEntry(key, value)
+	shard := c.lockShard(key)
+	old, found := c.liveLocked(shard, key)
+	if found {
+		old = old.pinned()
+	}
+	c.insertLocked(shard, e)
+	c.unlock(shard)
+	c.evictOverflow(shard)
+	if !found {
+		return nil, false
+	}
+	return c.valueOut(old), true
+}
+
+// GetAndDelete removes key and returns the value it held along with
+// whether it was present, atomically popping the item. Of several
+// goroutines calling GetAndDelete on the same key, only one receives the
+// value, which makes it suitable for consuming one-shot tokens. Expired
+// items are reported as absent. GetAndDelete returns nil and false on a
+// closed cache.
+func (c *Cache) GetAndDelete(key string) ([]byte, bool) {
+	key = c.normalize(key)
+	if c.writeErr() != nil {
+		return nil, false
+	}
+	shard := c.lockShard(key)
+	e, found := c.liveLocked(shard, key)
+	var value []byte
+	if found {
+		value = c.valueOut(e)
+		c.deleteLocked(shard, e)
+	}
+	c.unlock(shard)
+	return value, found
+}
@@ -0,0 +1,610 @@
+package infux
+
+import (
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Config holds the options used to construct a Cache with NewWithConfig.
+// The zero value is valid and produces the same cache as New.
+type Config struct {
+	// Shards is the number of shards to use. It must be zero or a
+	// power of two; zero selects the default of 256.
+	Shards int
+
+	// HashFunc hashes keys to select their shard. Only the low bits of
+	// the result are used, so they must be well distributed. It must be
+	// deterministic and safe for concurrent use. If nil, the built-in
+	// 64-bit FNV-1a hash is used.
+	HashFunc func(key string) uint64
+
+	// KeyNormalizer, if set, maps every key passed to the cache to the
+	// key it is stored under, so that keys with the same normalized form,
+	// such as keys differing only in case with strings.ToLower, are the
+	// same item. It is applied by every method that takes keys, before
+	// the key is hashed, and also to the keys given to Loader and
+	// subscribers. Keys reported by the cache, such as by Keys, ForEach,
+	// Snapshot and OnEvict, are the normalized keys; DeletePrefix and
+	// RangePrefix match prefixes against them as given. It must be
+	// deterministic, idempotent and safe for concurrent use. Nil stores
+	// keys as given.
+	KeyNormalizer func(key string) string
+
+	// InitialCapacity is a hint for the number of items the cache will
+	// hold. Each shard's map is allocated with room for its share, which
+	// avoids repeated map growth while the cache warms up. It is not a
+	// limit; see MaxEntries for that. Zero means no preallocation.
+	InitialCapacity int
+
+	// CleanupInterval is how often the background sweeper removes
+	// expired items. If it is zero or negative, the default, no sweeper
+	// is started and expiry is purely lazy: expired items are hidden from
+	// reads, and only removed when a Get, Has or write encounters them or
+	// DeleteExpired is called. The cache then runs no goroutines of its
+	// own, which suits short-lived caches, for example in serverless
+	// functions, while long-lived caches whose expired items are rarely
+	// read again should set an interval or call DeleteExpired.
+	CleanupInterval time.Duration
+
+	// CompactMaps makes the background sweeper, if CleanupInterval is
+	// set, also rebuild the map of every shard that once held more than
+	// 1024 items and now holds less than a quarter of its peak, as
+	// Compact does, so that a cache whose contents shrink after churn
+	// releases the memory Go maps keep for deleted items. Rebuilding a
+	// shard holds its write lock for time proportional to its item count.
+	CompactMaps bool
+
+	// BucketedExpiry makes every shard file its items that can expire in
+	// buckets by expiry time, one per CleanupInterval, or per second if no
+	// interval is set, so that the sweeper and DeleteExpired only visit
+	// the items of the buckets whose time has come, rather than every
+	// item of the cache. A sweep then costs time proportional to the
+	// number of items expiring, plus those whose deadline moved later,
+	// which it files again, instead of the number of items, which suits
+	// large caches where few items expire at a time. In exchange, every
+	// write of an item with a TTL or max idle time records its key in a
+	// bucket, and the records of items deleted or overwritten early are
+	// only dropped once their bucket comes due.
+	BucketedExpiry bool
+
+	// SlidingExpiration makes every successful lookup of an item written
+	// with a TTL extend its expiry to the lookup time plus that TTL, as
+	// if Touch had been called. Items that are read often then never
+	// expire. Lookups take the shard's write lock in this mode.
+	SlidingExpiration bool
+
+	// TTLJitter, if positive, spreads out the expiry of items written
+	// with a TTL: each item's expiry is moved by its own random offset of
+	// up to TTLJitter, earlier or later. Items written together with the
+	// same TTL, such as by SetMultiWithTTL while warming the cache, then
+	// expire gradually over a window of twice TTLJitter instead of all at
+	// once, which avoids a stampede of reloads. It applies wherever a TTL
+	// is set, including Touch, but not to the extensions of sliding
+	// expiration. It should be well below the TTLs in use.
+	TTLJitter time.Duration
+
+	// MaxEntries caps the number of items in the whole cache. When a
+	// write would exceed it, the least recently used item is evicted.
+	// Zero or negative means no limit. See Cache for how the limit is
+	// enforced.
+	MaxEntries int
+
+	// MaxEntriesPerShard caps the number of items in each shard. When a
+	// write would make its shard exceed it, an item of that shard is
+	// evicted as chosen by EvictionPolicy, so it is enforced entirely
+	// within the shard, with no coordination between shards. The cache
+	// as a whole then holds at most MaxEntriesPerShard times the number
+	// of shards, but keys rarely spread evenly: a shard receiving more
+	// keys than the others starts evicting while the cache is well below
+	// that total. Prefer MaxEntries unless eviction has to stay local.
+	// After a Resize, a shard over the cap shrinks on its next writes and
+	// sweeps, as bounded by MaxEvictionsPerWrite. It can be combined with
+	// the other limits. Zero or negative means no limit.
+	MaxEntriesPerShard int
+
+	// MaxBytes caps the total length of all keys and values in the
+	// cache, as reported by SizeBytes. When a write would exceed it,
+	// least recently used items are evicted until the cache fits.
+	// An item larger than MaxBytes on its own is never stored, and
+	// writing one removes any existing item under its key. If both
+	// MaxEntries and MaxBytes are set, items are evicted until both
+	// limits are satisfied. Zero or negative means no limit.
+	MaxBytes int64
+
+	// MaxCost caps the total cost of all items in the cache. Items
+	// stored with SetWithCost count for the cost given, and all other
+	// items for a cost of 1. When a write would exceed it, items are
+	// evicted until the cache fits, like for MaxBytes; an item whose cost
+	// alone exceeds MaxCost is never stored. It can be combined with the
+	// other limits. Zero or negative means no limit.
+	MaxCost int64
+
+	// MaxEvictionsPerWrite bounds the evictions of a single write while
+	// the cache is catching up with limits lowered by SetLimits, or with
+	// MaxEntriesPerShard after a Resize: the write then evicts at most
+	// that many items under its shard's lock, and as many again from
+	// other shards, so that no write stalls on a mass eviction. The
+	// background sweeper, if CleanupInterval is set, evicts the rest in
+	// batches of that size, releasing each shard's lock in between.
+	// Otherwise, as when the limits have never been lowered, writes evict
+	// as much as they need. Zero or negative selects
+	// DefaultMaxEvictionsPerWrite.
+	MaxEvictionsPerWrite int
+
+	// MaxValueBytes, if positive, is the largest value the cache accepts,
+	// as a guard against pathological writes. Writes of larger values
+	// are rejected, leaving any existing item in place: Set and the
+	// other methods without an error result silently store nothing,
+	// while TrySet returns ErrTooLarge and conditional writes report
+	// false. With a Compressor, the limit applies to the compressed
+	// value. Zero or negative means no limit.
+	MaxValueBytes int
+
+	// EvictionPolicy selects which items are evicted when MaxEntries,
+	// MaxBytes or MaxCost is exceeded. The default is PolicyLRU.
+	EvictionPolicy EvictionPolicy
+
+	// EvictionSampleSize, if positive, switches a bounded cache to sampled
+	// eviction, as memcached and Redis do: instead of keeping its items
+	// in order of use, each shard chooses every victim by comparing
+	// EvictionSampleSize of its items, starting from a random point of
+	// its map, and evicting the least recently used one, or the least
+	// frequently used or oldest one according to EvictionPolicy. Lookups
+	// then record accesses atomically under the shard's read lock instead
+	// of reordering a list under its write lock, in exchange for
+	// evictions that only approximate the policy: larger samples choose
+	// better victims but make each eviction slower. Samples of 5 to 16
+	// items work well in practice. With PolicyLFU, access counts are
+	// halved every time a shard has evicted as many items as it holds.
+	// RecencySampleRate has no effect with sampled eviction.
+	EvictionSampleSize int
+
+	// AdmissionPolicy selects whether a bounded cache stores a new item
+	// that would make it evict another one. The default, AdmitAll, always
+	// does; TinyLFU only does if the new key is used more often than the
+	// key it would evict, and otherwise drops the write, so Set and a
+	// Loader's results may not be stored at all. It has no effect on an
+	// unbounded cache.
+	AdmissionPolicy AdmissionPolicy
+
+	// RecencySampleRate, if between 0 and 1, is the fraction of lookup
+	// hits that update the recency of the item found for PolicyLRU and
+	// PolicyLFU, chosen at random. The other lookups only take the
+	// shard's read lock, which relieves lock contention on read-heavy
+	// caches at the cost of evictions that follow recency, and for
+	// PolicyLFU frequency, only approximately. It has no effect with
+	// SlidingExpiration, where every lookup extends the item's expiry.
+	// Otherwise, every lookup hit updates recency.
+	RecencySampleRate float64
+
+	// OnEvict, if set, is called whenever an item leaves the cache
+	// without being deleted explicitly: when it expires, is evicted to
+	// respect MaxEntries or MaxBytes, or is overwritten. Explicit removals
+	// such as Delete, DeletePrefix and Clear are not reported. The
+	// callback runs after the shard lock has been released, in the
+	// goroutine that caused the removal (the background sweeper for
+	// expirations it finds), so it may safely use the cache. It should
+	// return quickly, as it delays the operation that triggered it.
+	OnEvict func(key string, value []byte, reason EvictReason)
+
+	// OnEvictBatch is an alternative to OnEvict that receives the items
+	// leaving the cache in batches, one call per reason, so that many
+	// items expiring at once can be handled with one bulk operation
+	// downstream. Each sweep of the background sweeper or DeleteExpired
+	// reports all the items it removed in a single call; other removals
+	// are reported together with those made under the same shard lock,
+	// often in batches of one. Each Entry's TTL is its remaining time to
+	// live, 0 for expired items, or NoExpiry. Like OnEvict, it runs
+	// outside the shard locks and may use the cache. At most one of
+	// OnEvict and OnEvictBatch may be set; NewWithConfig panics if both
+	// are.
+	OnEvictBatch func(entries []Entry, reason EvictReason)
+
+	// Loader, if set, makes the cache read-through: when Get misses, it
+	// calls Loader to fetch the value from a backing store, stores the
+	// result without expiry and returns it. Concurrent misses on the same
+	// key share a single call. If Loader returns ErrNotFound, or any
+	// other error, Get reports a miss and nothing is cached, so the next
+	// Get tries again. Only Get loads; Has, GetWithTTL and the bulk
+	// operations never call Loader. It must be safe for concurrent use.
+	Loader func(key string) ([]byte, error)
+
+	// LoaderBreakerThreshold, if positive, puts a circuit breaker in
+	// front of Loader, to stop calling a backing store that is down.
+	// Once LoaderBreakerThreshold consecutive loads have failed, the
+	// first of them at most LoaderBreakerWindow before the last, the
+	// circuit opens: for LoaderBreakerCooldown, loads fail fast with an
+	// error wrapping ErrCircuitOpen, and Get reports a miss, without
+	// calling Loader. The next load after that probes the backing store,
+	// closing the circuit if it succeeds and opening it again if it
+	// fails, while other loads keep failing fast. A Loader returning
+	// ErrNotFound does not count as failing. Stats reports the state of
+	// the circuit. The window and cooldown default to
+	// DefaultLoaderBreakerWindow and DefaultLoaderBreakerCooldown.
+	LoaderBreakerThreshold int
+	LoaderBreakerWindow    time.Duration
+	LoaderBreakerCooldown  time.Duration
+
+	// BloomFilterSize enables bloom filters in front of the shards, sized
+	// for this many distinct keys across the cache. Every key written is
+	// added to its shard's filter, and Get reports a miss without locking
+	// the shard when the filter says the key was never written, which
+	// makes lookups of mostly absent keys cheaper. Keys that are deleted,
+	// evicted or expired stay in the filters, which only makes them let
+	// more lookups through; call RebuildBloomFilters periodically if the
+	// key set churns, and size the filters for the number of keys written
+	// between rebuilds. Each key takes about 10 bits. Zero disables the
+	// filters.
+	BloomFilterSize int
+
+	// TrackHotKeys, if positive, makes the cache track its most looked up
+	// keys, which HotKeys reports, to find candidates for a separate tier
+	// or a local cache. Lookups are counted with a bounded-memory heavy
+	// hitters algorithm, keeping up to 16 times TrackHotKeys counters,
+	// under one of 16 locks chosen by the key's hash, which adds a little
+	// overhead to every lookup. Without it, lookups are not tracked at
+	// all.
+	TrackHotKeys int
+
+	// TrackLatency makes the cache time every Get, Set, SetWithTTL,
+	// SetWithDeadline and TrySet call, for LatencyStats to report their
+	// latency quantiles, for example to tell whether lock contention hurts
+	// tail latency.
+	// Durations are counted in histograms updated with atomic operations
+	// only, but reading the clock twice per call slows down the fastest
+	// operations noticeably.
+	TrackLatency bool
+
+	// TrackAccess makes every item record the time of its last lookup
+	// and its number of lookups, which Meta reports. Recording them
+	// writes to the item on every hit, even under the shard's read lock,
+	// which costs a little time on read-heavy workloads.
+	TrackAccess bool
+
+	// TrackEvictionChurn, if positive, makes the cache remember the keys
+	// of its last TrackEvictionChurn evictions, so that EvictionStats can
+	// report the recent eviction rate and how many evicted keys were
+	// written again soon after. The keys are tracked under a single lock
+	// taken by every eviction and every write of a new key. Without it,
+	// evictions are only counted.
+	TrackEvictionChurn int
+
+	// MembershipIndex makes the cache keep an index of its keys beside
+	// the shards, so that Has answers without locking a shard. The index
+	// is updated under the shard lock by every write and removal, but
+	// read without it, so a Has racing with a write of the same key may
+	// see the key's state just before or just after the write. Hits found
+	// by Has alone are not marked as recently used. The index costs
+	// memory and a little time per write, and only pays off for caches
+	// dominated by Has calls on contended shards.
+	MembershipIndex bool
+
+	// RefreshThreshold enables refresh-ahead when Loader is set. When Get
+	// finds an item written with a TTL that expires within
+	// RefreshThreshold, it returns the current value immediately and
+	// reloads the item through Loader in the background, storing the
+	// result with the item's TTL; readers never block on a refresh. Only
+	// one refresh runs per key at a time. If the refresh fails, or the
+	// item is written or removed meanwhile, the item is left as is. Items
+	// without a TTL, or restored by Restore, are never refreshed.
+	RefreshThreshold time.Duration
+
+	// NegativeTTL enables negative caching. When Loader or a
+	// GetOrCompute function returns ErrNotFound, a tombstone for the key
+	// is kept for NegativeTTL, during which Get reports a miss and
+	// GetOrCompute returns ErrNotFound without calling the backing store
+	// again. Writing the key removes its tombstone. Tombstones are not
+	// items: they do not count toward Len, SizeBytes, MaxEntries or
+	// MaxBytes, and are removed by the background sweeper once expired.
+	// Zero or negative disables negative caching.
+	NegativeTTL time.Duration
+
+	// SkipEqualWrites makes Set, SetWithTTL, SetWithDeadline and TrySet
+	// compare the new value with the item they would replace, and skip
+	// replacing it if the values are equal, only giving the item its new
+	// expiry. This saves copying the value, storing a new item and
+	// notifying OnEvict and subscribers when producers resend unchanged
+	// values. It costs a comparison of the values under the read lock on
+	// every write over an existing item, which with a Compressor means
+	// decompressing it. Skipped writes still count as sets in Stats. It is
+	// off by default.
+	SkipEqualWrites bool
+
+	// CopyOnGet makes every read return a fresh copy of the stored value,
+	// so callers may modify it without corrupting the cached data seen
+	// by others. CopyOnSet makes every write store a copy of the given
+	// value, so callers may reuse or modify their slice afterwards. Each
+	// costs one allocation and copy per operation, proportional to the
+	// value size. Both are off by default: values are shared with the
+	// caller and must be treated as read-only.
+	CopyOnGet bool
+	CopyOnSet bool
+
+	// Logger receives structured records of the cache's significant
+	// events, and never of successful reads and writes:
+	//
+	//   - Error: the Loader, OnEvict or OnEvictBatch panicked, with the
+	//     panic value and stack; a value failed its VerifyChecksums check;
+	//     reading or writing the Persist snapshot file failed.
+	//   - Warn: the Loader failed with an error other than ErrNotFound;
+	//     its circuit breaker opened.
+	//   - Info: the circuit breaker closed again.
+	//   - Debug: an item was evicted to respect the limits, with its key,
+	//     logged under the shard's lock; the sweeper removed expired
+	//     items, with their number and the sweep's duration; a shard map
+	//     was compacted.
+	//
+	// Panics are recovered, so that a broken callback cannot kill the
+	// cache's background goroutines or leave a shard locked: a panicking
+	// Loader counts as a failed load, returning an error wrapping
+	// ErrPanicked, and a panicking eviction callback only loses that
+	// notification. Functions passed to a single call, such as Update's,
+	// are not recovered: the cache releases its locks and lets their
+	// panics propagate to the caller. The default is slog.Default(); a
+	// logger whose handler discards everything silences the cache.
+	Logger *slog.Logger
+
+	// VerifyChecksums makes the cache store a CRC-32C checksum of every
+	// value it stores, and check it on every lookup that finds the item,
+	// to detect a value corrupted in memory, typically by a caller
+	// modifying a slice it passed to Set or got from Get, which the cache
+	// shares unless CopyOnSet and CopyOnGet are set. A lookup finding a
+	// corrupted item logs an error to Logger and reports a miss, so that
+	// Get loads the item again through Loader, if set, replacing it;
+	// otherwise the item stays corrupted until written again or removed.
+	// Checksums cost 4 bytes per item and a pass over the value on every
+	// write and every hit, under the shard's lock, on the order of 0.1 ns
+	// per byte on CPUs with CRC instructions. It is off by default.
+	VerifyChecksums bool
+
+	// SpinBeforeBlock makes an operation finding its shard locked retry
+	// the lock a few dozen times before blocking, rather than park its
+	// goroutine at once, which pays off when critical sections, like
+	// most of the cache's, are shorter than a park and wake-up. It helps
+	// on heavily contended shards with more CPUs than goroutines
+	// competing for them, and wastes CPU time otherwise: a spinning
+	// goroutine delays others sharing its CPU, and does nothing for a
+	// lock held across an eviction callback or a long scan. It is
+	// ignored if GOMAXPROCS is 1, where the lock holder cannot run while
+	// another goroutine spins. Adding shards is usually the better cure
+	// for contention spread over many keys; spinning targets a few hot
+	// keys. It is off by default.
+	SpinBeforeBlock bool
+
+	// Tracer, if set, receives a span for every GetCtx and SetCtx call,
+	// for example to show cache operations in OpenTelemetry traces. The
+	// spans carry the operation's key, which HashTraceKeys replaces with
+	// a hexadecimal hash of it, to keep keys holding personal data out of
+	// the traces while still telling operations on the same key apart.
+	// Other methods are never traced, and without a Tracer, GetCtx and
+	// SetCtx cost nothing over Get and Set.
+	Tracer        Tracer
+	HashTraceKeys bool
+
+	// Persist makes the cache durable across restarts by keeping a
+	// snapshot file, in the format of Snapshot, up to date. If the file
+	// exists when the cache is created, its live items are restored
+	// first, as by Restore. A background goroutine then rewrites the file
+	// every Persist.Interval if the cache changed meanwhile, so that any
+	// burst of writes costs one write of the file, and a last time when
+	// the cache is closed. Writes never wait for the disk, and the file is
+	// replaced atomically, but changes made since the last write are lost
+	// on a crash. Errors reading or writing the file are logged to
+	// Logger.
+	Persist PersistConfig
+
+	// Arena makes the cache copy the values given to it, like CopyOnSet,
+	// but packed into shared 1 MiB chunks instead of one allocation per
+	// value, for very large caches of small values where the number of
+	// heap objects makes garbage collection expensive. Values over 64 KiB
+	// are still allocated on their own. A chunk is only freed once every
+	// value in it has been deleted or overwritten, so a cache with a lot
+	// of churn may hold much more memory than SizeBytes reports. Entries
+	// remain separate objects, so this reduces the garbage collector's
+	// work per value but does not remove it. Arena is experimental.
+	Arena bool
+
+	// PooledValues makes the cache copy the values given to it, like
+	// CopyOnSet, into buffers taken from pools of power-of-two sizes up to
+	// 1 MiB, and return each buffer to its pool once the value in it has
+	// been overwritten or removed and no Value returned by GetRef still
+	// references it, so that a cache with a lot of churn in large values
+	// reuses their memory rather than allocating anew. Reads other than
+	// GetRef, including Get, iteration and eviction callbacks, then always
+	// return copies, whatever CopyOnGet says; GetRef returns the buffer
+	// itself, pinned until the Value is released. Callers must release
+	// every such Value: one that is never released keeps its buffer from
+	// being reused. Rounding buffers up to a power of two may waste up to
+	// half of each. It cannot be combined with Arena.
+	PooledValues bool
+
+	// Compressor, if set, compresses values as they are stored and
+	// decompresses them as they are read, trading CPU time for memory.
+	// Values shorter than 64 bytes, or that do not shrink, are stored
+	// uncompressed. Every read of a compressed value returns a fresh
+	// copy. MaxBytes and SizeBytes count compressed sizes, while values
+	// passed to callbacks and written by Snapshot are uncompressed.
+	// GzipCompressor is provided; the infuxs2 module provides a faster
+	// S2 compressor.
+	Compressor Compressor
+}
+
+// NewWithConfig creates and returns a new Cache configured by cfg.
+// If cfg.CleanupInterval is positive, a background goroutine is started
+// to sweep expired items. Call Close to stop it.
+// It panics if cfg.Shards is neither zero nor a power of two, or if both
+// cfg.OnEvict and cfg.OnEvictBatch are set.
+func NewWithConfig(cfg Config) *Cache {
+	return newWithConfig(cfg, realClock{})
+}
+
+// newWithConfig implements NewWithConfig for a cache telling the time by
+// clk, which is in place before any background goroutine starts.
+func newWithConfig(cfg Config, clk clock) *Cache {
+	var c *Cache
+	if cfg.Shards == 0 {
+		c = New()
+	} else {
+		c = NewWithShards(cfg.Shards)
+	}
+	c.clock = clk
+	shards := c.table().shards
+	cfg.Shards = len(shards)
+	c.cfg = cfg
+	if cfg.InitialCapacity > 0 {
+		perShard := (cfg.InitialCapacity + len(shards) - 1) / len(shards)
+		for _, shard := range shards {
+			shard.items = make(map[string]*entry, perShard)
+			shard.peak = perShard
+		}
+		c.shardCapacity = perShard
+	}
+	if cfg.HashFunc != nil {
+		c.hash = cfg.HashFunc
+	}
+	c.normalizeKey = cfg.KeyNormalizer
+	if cfg.TrackHotKeys > 0 {
+		c.hotKeys = cfg.TrackHotKeys
+		c.hot = make([]*hotKeys, hotKeyStripes)
+		for i := range c.hot {
+			c.hot[i] = newHotKeys(cfg.TrackHotKeys)
+		}
+	}
+	c.trackAccess = cfg.TrackAccess
+	if cfg.TrackLatency {
+		c.latency = &latencyRecorder{}
+	}
+	if cfg.TrackEvictionChurn > 0 {
+		c.churn = newChurnTracker(cfg.TrackEvictionChurn)
+	}
+	if cfg.MembershipIndex {
+		c.index = &sync.Map{}
+	}
+	if cfg.BloomFilterSize > 0 {
+		c.bloomKeys = cfg.BloomFilterSize
+		for _, shard := range shards {
+			shard.bloom.Store(c.newBloomFilterForShard(len(shards)))
+		}
+	}
+	if cfg.MaxEntries > 0 {
+		c.maxEntries.Store(int64(cfg.MaxEntries))
+	}
+	if cfg.MaxEntriesPerShard > 0 {
+		c.maxShardEntries = cfg.MaxEntriesPerShard
+	}
+	if cfg.MaxBytes > 0 {
+		c.maxBytes.Store(cfg.MaxBytes)
+	}
+	if cfg.MaxValueBytes > 0 {
+		c.maxValueBytes = cfg.MaxValueBytes
+	}
+	if cfg.MaxCost > 0 {
+		c.maxCost.Store(cfg.MaxCost)
+	}
+	c.bounded = cfg.MaxEntries > 0 || c.maxShardEntries > 0 || cfg.MaxBytes > 0 || cfg.MaxCost > 0
+	c.maxEvictions = DefaultMaxEvictionsPerWrite
+	if cfg.MaxEvictionsPerWrite > 0 {
+		c.maxEvictions = cfg.MaxEvictionsPerWrite
+	}
+	c.policy = cfg.EvictionPolicy
+	if c.bounded && cfg.AdmissionPolicy == TinyLFU {
+		width := sketchDefaultWidth
+		if cfg.MaxEntries > 0 {
+			width = cfg.MaxEntries
+		} else if c.maxShardEntries > 0 {
+			width = c.maxShardEntries * len(shards)
+		}
+		c.sketch = newFrequencySketch(width)
+	}
+	if cfg.OnEvict != nil && cfg.OnEvictBatch != nil {
+		panic("infux: only one of OnEvict and OnEvictBatch may be set")
+	}
+	c.onEvict = cfg.OnEvict
+	c.onEvictBatch = cfg.OnEvictBatch
+	c.loader = cfg.Loader
+	if cfg.LoaderBreakerThreshold > 0 && c.loader != nil {
+		c.breaker = &loaderBreaker{
+			threshold: cfg.LoaderBreakerThreshold,
+			window:    int64(DefaultLoaderBreakerWindow),
+			cooldown:  int64(DefaultLoaderBreakerCooldown),
+		}
+		if cfg.LoaderBreakerWindow > 0 {
+			c.breaker.window = int64(cfg.LoaderBreakerWindow)
+		}
+		if cfg.LoaderBreakerCooldown > 0 {
+			c.breaker.cooldown = int64(cfg.LoaderBreakerCooldown)
+		}
+	}
+	if cfg.RefreshThreshold > 0 && c.loader != nil {
+		c.refreshThreshold = cfg.RefreshThreshold
+	}
+	if cfg.NegativeTTL > 0 {
+		c.negativeTTL = cfg.NegativeTTL
+	}
+	c.sliding = cfg.SlidingExpiration
+	if cfg.TTLJitter > 0 {
+		c.ttlJitter = cfg.TTLJitter
+	}
+	c.skipEqualWrites = cfg.SkipEqualWrites
+	c.copyOnGet = cfg.CopyOnGet
+	c.copyOnSet = cfg.CopyOnSet
+	if cfg.Logger != nil {
+		c.logger = cfg.Logger
+	}
+	c.verifyChecksums = cfg.VerifyChecksums
+	c.compactMaps = cfg.CompactMaps
+	if cfg.BucketedExpiry {
+		c.bucketWidth = int64(time.Second)
+		if cfg.CleanupInterval > 0 {
+			c.bucketWidth = int64(cfg.CleanupInterval)
+		}
+	}
+	if cfg.SpinBeforeBlock && runtime.GOMAXPROCS(0) > 1 {
+		c.spinLocks = true
+		// The cache is not shared yet, so its shards need no locking.
+		for _, shard := range c.table().shards {
+			shard.mu.spin = true
+		}
+	}
+	c.tracer = cfg.Tracer
+	c.hashTraceKeys = cfg.HashTraceKeys
+	if cfg.Arena && cfg.PooledValues {
+		panic("infux: only one of Arena and PooledValues may be set")
+	}
+	if cfg.Arena {
+		c.arena = &valueArena{}
+	}
+	if cfg.PooledValues {
+		c.pooled, c.copyOnSet = true, true
+	}
+	c.compressor = cfg.Compressor
+	// FIFO order is fixed at insertion, and sampled eviction records
+	// accesses atomically, so only the LRU lists of the other policies
+	// need lookups to take the write lock.
+	if c.bounded && cfg.EvictionSampleSize > 0 {
+		c.sampled = cfg.EvictionSampleSize
+	}
+	c.ordered = c.bounded && c.sampled == 0
+	c.lookupWrites = c.ordered && c.policy != PolicyFIFO || c.sliding
+	if cfg.RecencySampleRate > 0 && cfg.RecencySampleRate < 1 {
+		c.recencySampleRate = cfg.RecencySampleRate
+	}
+	if cfg.CleanupInterval > 0 {
+		c.startWorker(func(stop <-chan struct{}) {
+			c.runCleanup(cfg.CleanupInterval, stop)
+		})
+	}
+	if cfg.Persist.Path != "" {
+		c.persist = &persister{path: cfg.Persist.Path, interval: DefaultPersistInterval}
+		if cfg.Persist.Interval > 0 {
+			c.persist.interval = cfg.Persist.Interval
+		}
+		c.loadPersisted()
+		// Restoring is no change to write back.
+		c.persist.dirty.Store(false)
+		c.startWorker(c.runPersist)
+	}
+	return c
+}
@@ -0,0 +1,55 @@
+package infux
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHashFuncRoutesKeys(t *testing.T) {
+	// The hash of each key is the number it spells, with high bits set
+	// that the mask of 16 shards must discard.
+	hash := func(key string) uint64 {
+		n, _ := strconv.ParseUint(key, 10, 64)
+		return n | 0xffff_0000_0000_0000
+	}
+	c := NewWithConfig(Config{Shards: 16, HashFunc: hash})
+	for _, tc := range []struct {
+		key   string
+		shard int
+	}{
+		{"0", 0}, {"1", 1}, {"15", 15}, {"16", 0}, {"33", 1}, {"4294967311", 15},
+	} {
+		if got := c.ShardIndex(tc.key); got != tc.shard {
+			t.Errorf("ShardIndex(%q) = %d, want %d", tc.key, got, tc.shard)
+		}
+		c.Set(tc.key, []byte("v"))
+		if _, found := c.table().shards[tc.shard].items[tc.key]; !found {
+			t.Errorf("%q not stored in shard %d", tc.key, tc.shard)
+		}
+	}
+}
+
+func TestLazyExpiryStartsNoGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	c, clk := newTestCache(Config{MaxEntries: 100})
+	c.SetWithTTL("a", []byte("v"), time.Minute)
+	c.SetWithTTL("b", []byte("v"), time.Minute)
+	if n := runtime.NumGoroutine(); n != before {
+		t.Fatalf("%d goroutines running after New, want %d", n, before)
+	}
+	if leaked := leakedGoroutines(); len(leaked) != 0 {
+		t.Fatalf("cache without CleanupInterval started a goroutine:\n%s", leaked[0])
+	}
+	clk.Advance(time.Minute)
+	if c.Has("a") {
+		t.Fatal("Has found an expired item")
+	}
+	if removed := c.DeleteExpired(); removed != 1 {
+		t.Fatalf("DeleteExpired removed %d items, want the 1 not yet encountered", removed)
+	}
+	if c.Len() != 0 {
+		t.Fatalf("Len = %d, want 0", c.Len())
+	}
+}
@@ -0,0 +1,70 @@
+package infux
+
+import (
+	"bytes"
+	"io"
+)
+
+// Values stored in the cache are never modified in place: every update
+// stores a new slice. This lets reads hand out the stored slice, or copy
+// it, without holding the shard lock for longer than the lookup.
+
+// GetCopy is like Get, but always returns a fresh copy of the value that
+// the caller owns and may modify, regardless of Config.CopyOnGet.
+func (c *Cache) GetCopy(key string) ([]byte, bool) {
+	value, found := c.Get(key)
+	if !found || c.copyOnGet {
+		return value, found
+	}
+	return cloneBytes(value), true
+}
+
+// GetReader is like Get, but returns a reader of the value, for example
+// to stream a large value to an HTTP response with io.Copy. The reader
+// reads the stored value without copying it, even with Config.CopyOnGet,
+// since reading cannot modify it. Because the cache never modifies stored
+// values, later writes or deletes of the key do not affect a reader
+// already returned; but without Config.CopyOnSet, a caller that modifies
+// a slice after storing it also changes what readers of it see. A
+// compressed value is decompressed into a fresh copy for the reader.
+func (c *Cache) GetReader(key string) (io.Reader, bool) {
+	key = c.normalize(key)
+	if e, found := c.lookup(key); found {
+		return bytes.NewReader(c.valueOf(e)), true
+	}
+	if c.loader == nil {
+		return nil, false
+	}
+	value, err := c.load(key)
+	if err != nil {
+		return nil, false
+	}
+	return bytes.NewReader(value), true
+}
+
+// copyIn returns the value to store for a value passed in by the caller.
+func (c *Cache) copyIn(value []byte) []byte {
+	if c.arena != nil {
+		return c.arena.copy(value)
+	}
+	if !c.copyOnSet {
+		return value
+	}
+	return cloneBytes(value)
+}
+
+// copyOut returns the value to hand out for a stored value.
+func (c *Cache) copyOut(value []byte) []byte {
+	if !c.copyOnGet {
+		return value
+	}
+	return cloneBytes(value)
+}
+
+// cloneBytes returns a copy of b, preserving nil.
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append(make([]byte, 0, len(b)), b...)
+}
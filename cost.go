@@ -0,0 +1,24 @@
+package infux
+
+// SetWithCost adds an item to the cache like Set, but with the given
+// cost counting toward Config.MaxCost instead of the default cost of 1.
+// Costs let items that are expensive to recompute claim more of the
+// budget than cheap ones. A zero or negative cost means the default.
+//
+// The cost belongs to the stored value: any later write to the key,
+// including Replace, Append and Increment, stores the new value with the
+// default cost, and Snapshot does not record costs.
+func (c *Cache) SetWithCost(key string, value []byte, cost int64) {
+	key = c.normalize(key)
+	e := c.newEntry(key, value)
+	e.cost = cost
+	c.set(e)
+}
+
+// weight returns the cost e counts for toward Config.MaxCost.
+func (e *entry) weight() int64 {
+	if e.cost > 0 {
+		return e.cost
+	}
+	return 1
+}
@@ -0,0 +1,55 @@
+package infux
+
+import "time"
+
+// Entry is an item streamed out of the cache by DrainTo, or reported to
+// Config.OnEvictBatch.
+type Entry struct {
+	Key   string
+	Value []byte
+	// TTL is the item's remaining time-to-live, or NoExpiry if it never
+	// expires. Passing it to SetWithTTL recreates the item with the same
+	// expiry.
+	TTL time.Duration
+}
+
+// DrainTo removes every item from the cache and sends the live ones on
+// ch, for example to migrate them to another cache or persist them
+// without holding two copies of the whole cache in memory. Shards are
+// drained one at a time: the items of a shard are collected and removed
+// under its write lock and sent after it is released, so a slow receiver
+// blocks neither readers nor writers, and may use the cache itself. Only
+// one shard's items are held outside the cache at a time. DrainTo blocks
+// until ch accepts every item, and the order of items is unspecified.
+// Items written concurrently to an already drained shard remain in the
+// cache. Removed items are not reported to OnEvict or counted as
+// deletes. DrainTo does not close ch, and is a no-op on a closed cache.
+func (c *Cache) DrainTo(ch chan<- Entry) {
+	if c.writeErr() != nil {
+		return
+	}
+	for _, shard := range c.table().shards {
+		for _, item := range c.drainShard(shard) {
+			ch <- item
+		}
+	}
+}
+
+// drainShard removes every item from shard and returns the live ones.
+func (c *Cache) drainShard(shard *cacheShard) []Entry {
+	shard.mu.Lock()
+	defer c.unlock(shard)
+	now := c.now()
+	items := make([]Entry, 0, len(shard.items))
+	for key, e := range shard.items {
+		if !e.expired(now) {
+			ttl := NoExpiry
+			if at := e.deadline(); at != 0 {
+				ttl = time.Duration(at - now)
+			}
+			items = append(items, Entry{Key: key, Value: c.valueOut(e), TTL: ttl})
+		}
+		c.removeLocked(shard, e)
+	}
+	return items
+}
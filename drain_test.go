@@ -0,0 +1,56 @@
+package infux
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrainToEmptiesCache(t *testing.T) {
+	c := New()
+	for i := 0; i < 100; i++ {
+		c.Set(fmt.Sprint(i), []byte("v"))
+	}
+	c.SetWithTTL("ttl", []byte("v"), time.Hour)
+	ch := make(chan Entry)
+	go func() {
+		c.DrainTo(ch)
+		close(ch)
+	}()
+	n := 0
+	for item := range ch {
+		n++
+		if item.Key == "ttl" && (item.TTL <= 0 || item.TTL > time.Hour) {
+			t.Errorf("TTL of drained item = %v, want within an hour", item.TTL)
+		}
+		if item.Key != "ttl" && item.TTL != NoExpiry {
+			t.Errorf("TTL of %q = %v, want NoExpiry", item.Key, item.TTL)
+		}
+	}
+	if n != 101 || c.Len() != 0 {
+		t.Fatalf("drained %d items leaving %d, want 101 and 0", n, c.Len())
+	}
+}
+
+func TestDrainToReceiverMayUseCache(t *testing.T) {
+	src, dst := New(), New()
+	src.Set("a", []byte("1"))
+	src.Set("b", []byte("2"))
+	ch := make(chan Entry)
+	go func() {
+		src.DrainTo(ch)
+		close(ch)
+	}()
+	for item := range ch {
+		// Writes to the drained cache must not deadlock. They may land
+		// in shards not drained yet, and come back.
+		if !strings.HasPrefix(item.Key, "written-") {
+			src.Set("written-"+item.Key, item.Value)
+		}
+		dst.SetWithTTL(item.Key, item.Value, item.TTL)
+	}
+	if !dst.Has("a") || !dst.Has("b") {
+		t.Fatal("drained items missing from dst")
+	}
+}
@@ -0,0 +1,38 @@
+package infux
+
+import "errors"
+
+// ErrClosed is returned by operations on a Cache that has been closed.
+var ErrClosed = errors.New("infux: cache is closed")
+
+// ErrFrozen is returned by writes to a Cache that has been frozen with
+// Freeze.
+var ErrFrozen = errors.New("infux: cache is frozen")
+
+// ErrPanicked is wrapped by the error returned in place of a result when
+// a callback of the cache, such as the Loader, panics.
+var ErrPanicked = errors.New("infux: callback panicked")
+
+// ErrNotFound reports that a key is not present. A Loader returns it to
+// signal that the backing store has no value for a key.
+var ErrNotFound = errors.New("infux: not found")
+
+// ErrKeyExists is returned by Add when the key is already present.
+var ErrKeyExists = errors.New("infux: key already exists")
+
+// ErrNotStored is returned by Add when the cache declines to store an
+// item, because its value exceeds Config.MaxValueBytes, it could never fit
+// the cache's limits, or TinyLFU admission rejected it.
+var ErrNotStored = errors.New("infux: item not stored")
+
+// ErrTooLarge is returned when a write would make a value larger than the
+// allowed limit.
+var ErrTooLarge = errors.New("infux: value too large")
+
+// ErrNotInteger is returned by counter operations when the stored value
+// is not a decimal integer.
+var ErrNotInteger = errors.New("infux: value is not an integer")
+
+// ErrOverflow is returned by counter operations when the result would not
+// fit in an int64.
+var ErrOverflow = errors.New("infux: integer overflow")
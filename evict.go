@@ -0,0 +1,126 @@
+package infux
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// EvictReason describes why an item left the cache without being deleted
+// explicitly.
+type EvictReason int
+
+const (
+	// ReasonExpired means the item's time-to-live had passed.
+	ReasonExpired EvictReason = iota + 1
+	// ReasonEvicted means the item was removed to keep the cache within
+	// its entry or byte limits.
+	ReasonEvicted
+	// ReasonReplaced means the item was overwritten by a new value for
+	// the same key.
+	ReasonReplaced
+)
+
+// String returns a lower-case name for the reason.
+func (r EvictReason) String() string {
+	switch r {
+	case ReasonExpired:
+		return "expired"
+	case ReasonEvicted:
+		return "evicted"
+	case ReasonReplaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// eviction is a removed entry waiting to be reported to OnEvict.
+type eviction struct {
+	key        string
+	value      []byte
+	compressed bool
+	expiresAt  int64
+	reason     EvictReason
+}
+
+// evictLocked removes e from shard for the given reason and, if an
+// OnEvict or OnEvictBatch callback is configured, queues it for
+// delivery when the lock is released with unlock. The caller must hold
+// the shard's write lock.
+func (c *Cache) evictLocked(shard *cacheShard, e *entry, reason EvictReason) {
+	value := e.value
+	if c.onEvict != nil || c.onEvictBatch != nil {
+		// Copy a pooled value before removeLocked recycles its buffer.
+		value = e.pinned().value
+	}
+	c.removeLocked(shard, e)
+	switch reason {
+	case ReasonEvicted:
+		shard.stats.evictions.Add(1)
+		if shard.capture != nil {
+			*shard.capture = append(*shard.capture, e.key)
+		}
+		if c.churn != nil {
+			c.churn.evicted(e.key, c.now())
+		}
+		if c.logger.Enabled(context.Background(), slog.LevelDebug) {
+			c.logger.Debug("infux: evicted item", "key", e.key, "bytes", e.size())
+		}
+	case ReasonExpired:
+		shard.stats.expirations.Add(1)
+	}
+	if c.onEvict != nil || c.onEvictBatch != nil {
+		shard.evicted = append(shard.evicted, eviction{
+			key:        e.key,
+			value:      value,
+			compressed: e.compressed,
+			expiresAt:  e.deadline(),
+			reason:     reason,
+		})
+	}
+}
+
+// unlock releases the shard's write lock, then delivers any evictions
+// queued while it was held to the OnEvict or OnEvictBatch callback.
+// Running the callback outside the lock lets it use the cache without
+// deadlocking.
+func (c *Cache) unlock(shard *cacheShard) {
+	if len(shard.evicted) == 0 {
+		shard.mu.Unlock()
+		return
+	}
+	evicted := shard.evicted
+	shard.evicted = nil
+	shard.mu.Unlock()
+	c.deliver(evicted)
+}
+
+// deliver reports evictions to the OnEvict callback one by one, or to the
+// OnEvictBatch callback in one batch per reason. A panicking callback is
+// logged and does not stop the other evictions from being reported. The
+// caller must not hold any shard lock.
+func (c *Cache) deliver(evicted []eviction) {
+	if c.onEvict != nil {
+		for _, ev := range evicted {
+			value := c.decode(ev.value, ev.compressed)
+			c.guard("OnEvict", func() { c.onEvict(ev.key, value, ev.reason) })
+		}
+		return
+	}
+	now := c.now()
+	var batches [ReasonReplaced + 1][]Entry
+	for _, ev := range evicted {
+		ttl := NoExpiry
+		if ev.expiresAt != 0 {
+			ttl = max(time.Duration(ev.expiresAt-now), 0)
+		}
+		entry := Entry{Key: ev.key, Value: c.decode(ev.value, ev.compressed), TTL: ttl}
+		batches[ev.reason] = append(batches[ev.reason], entry)
+	}
+	for reason, entries := range batches {
+		if len(entries) > 0 {
+			c.guard("OnEvictBatch", func() { c.onEvictBatch(entries, EvictReason(reason)) })
+		}
+	}
+}
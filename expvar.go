@@ -0,0 +1,42 @@
+package infux
+
+import "expvar"
+
+// expvarStats is the JSON object published by PublishExpvar.
+type expvarStats struct {
+	Hits        uint64  `json:"hits"`
+	Misses      uint64  `json:"misses"`
+	Sets        uint64  `json:"sets"`
+	Deletes     uint64  `json:"deletes"`
+	Evictions   uint64  `json:"evictions"`
+	Expirations uint64  `json:"expirations"`
+	HitRatio    float64 `json:"hit_ratio"`
+	AvgValue    float64 `json:"avg_value_bytes"`
+	MaxValue    int64   `json:"max_value_bytes"`
+	Len         int     `json:"len"`
+	SizeBytes   int64   `json:"size_bytes"`
+}
+
+// PublishExpvar publishes the statistics of c as the expvar variable
+// name, so that they are served as a JSON object at /debug/vars alongside
+// the other expvar variables. The counters and the hit ratio are derived
+// from a single call to Stats, so they always agree with each other.
+// Like expvar.Publish, it panics if name is already registered.
+func PublishExpvar(name string, c *Cache) {
+	expvar.Publish(name, expvar.Func(func() any {
+		stats := c.Stats()
+		return expvarStats{
+			Hits:        stats.Hits,
+			Misses:      stats.Misses,
+			Sets:        stats.Sets,
+			Deletes:     stats.Deletes,
+			Evictions:   stats.Evictions,
+			Expirations: stats.Expirations,
+			HitRatio:    stats.HitRatio(),
+			AvgValue:    stats.AvgValueBytes,
+			MaxValue:    stats.MaxValueBytes,
+			Len:         c.Len(),
+			SizeBytes:   c.SizeBytes(),
+		}
+	}))
+}
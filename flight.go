@@ -0,0 +1,72 @@
+package infux
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errComputePanicked is returned to callers waiting on a computation whose
+// function panicked. The panic itself propagates in the goroutine that
+// ran the function.
+var errComputePanicked = errors.New("infux: compute function panicked")
+
+// flightCall is an in-flight or completed computation of a key's value.
+type flightCall struct {
+	// done is closed once val and err are set.
+	done chan struct{}
+	val  []byte
+	err  error
+}
+
+// flightGroup coalesces concurrent computations of the same key so that
+// only one of them runs at a time. The zero value is ready to use.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do runs fn for key unless a computation for key is already in flight,
+// in which case it waits for that computation and returns its result.
+// shared reports whether the result came from another caller's
+// computation. If ctx is done while waiting, do returns ctx.Err() at once;
+// the computation itself carries on for the other callers.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() ([]byte, error)) (val []byte, err error, shared bool) {
+	g.mu.Lock()
+	if call, found := g.calls[key]; found {
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.val, call.err, true
+		case <-ctx.Done():
+			return nil, ctx.Err(), true
+		}
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call := &flightCall{done: make(chan struct{}), err: errComputePanicked}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.val, call.err = fn()
+	return call.val, call.err, false
+}
+
+// load fetches key through the configured Loader, coalescing concurrent
+// loads of the same key, and stores the result on success.
+func (c *Cache) load(key string) ([]byte, error) {
+	if c.closed.Load() {
+		return nil, ErrClosed
+	}
+	value, err, _ := c.compute(context.Background(), key, func() ([]byte, error) {
+		return c.callLoader(key)
+	})
+	return value, err
+}
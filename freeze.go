@@ -0,0 +1,39 @@
+package infux
+
+// Freeze makes the cache read-only until Unfreeze, for example while
+// taking a consistent Snapshot or during maintenance. While frozen, reads
+// work as usual, but every write is rejected as on a closed cache, except
+// that writes reporting an error return ErrFrozen: Set and its variants,
+// deletes, Clear, conditional writes, counters, Touch, Restore and the
+// writes of Transaction and ShardView are all skipped. Values produced by
+// the Loader, GetOrCompute and background refreshes are returned but not
+// stored. Expired items are still removed, by Get, the sweeper and
+// DeleteExpired, and capacity evictions still happen. Freezing is a
+// single atomic flag checked before each write takes its lock, so writes
+// already past the check when Freeze is called still complete; Freeze
+// does not wait for them.
+func (c *Cache) Freeze() {
+	c.frozen.Store(true)
+}
+
+// Unfreeze makes a frozen cache accept writes again.
+func (c *Cache) Unfreeze() {
+	c.frozen.Store(false)
+}
+
+// Frozen reports whether the cache is frozen.
+func (c *Cache) Frozen() bool {
+	return c.frozen.Load()
+}
+
+// writeErr returns ErrClosed if the cache is closed, ErrFrozen if it is
+// frozen, and nil if it accepts writes.
+func (c *Cache) writeErr() error {
+	switch {
+	case c.closed.Load():
+		return ErrClosed
+	case c.frozen.Load():
+		return ErrFrozen
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package infux
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFreezeRejectsWrites(t *testing.T) {
+	c := New()
+	c.Set("k", []byte("v"))
+	c.Freeze()
+	if !c.Frozen() {
+		t.Fatal("Frozen = false after Freeze")
+	}
+	c.Set("k", []byte("changed"))
+	c.Set("new", []byte("v"))
+	c.Delete("k")
+	c.CompareAndSwap("k", []byte("v"), []byte("swapped"))
+	c.Clear()
+	if v, found := c.Get("k"); !found || string(v) != "v" {
+		t.Fatalf("Get = %q, %v while frozen, want the value from before Freeze", v, found)
+	}
+	if c.Has("new") || c.Len() != 1 {
+		t.Fatal("a write went through while frozen")
+	}
+	if err := c.TrySet("k", []byte("v")); !errors.Is(err, ErrFrozen) {
+		t.Fatalf("TrySet = %v, want ErrFrozen", err)
+	}
+	if err := c.Add("other", []byte("v")); !errors.Is(err, ErrFrozen) {
+		t.Fatalf("Add = %v, want ErrFrozen", err)
+	}
+	if _, err := c.Increment("n", 1); !errors.Is(err, ErrFrozen) {
+		t.Fatalf("Increment = %v, want ErrFrozen", err)
+	}
+
+	c.Unfreeze()
+	if c.Frozen() {
+		t.Fatal("Frozen = true after Unfreeze")
+	}
+	c.Set("k", []byte("changed"))
+	if v, _ := c.Get("k"); string(v) != "changed" {
+		t.Fatalf("Get = %q after Unfreeze and Set, want %q", v, "changed")
+	}
+	if err := c.TrySet("new", []byte("v")); err != nil {
+		t.Fatalf("TrySet = %v after Unfreeze", err)
+	}
+}
+
+func TestFreezeKeepsLoadedValuesOut(t *testing.T) {
+	c := NewWithConfig(Config{Loader: func(key string) ([]byte, error) {
+		return []byte("loaded"), nil
+	}})
+	c.Freeze()
+	if v, found := c.Get("k"); !found || string(v) != "loaded" {
+		t.Fatalf("Get = %q, %v, want the loaded value returned", v, found)
+	}
+	if c.Len() != 0 {
+		t.Fatal("loaded value stored while frozen")
+	}
+}
@@ -0,0 +1,62 @@
+package infux
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+)
+
+// GobCache is a view of a Cache that stores arbitrary Go values by
+// encoding them with encoding/gob, sparing callers the marshaling
+// boilerplate. It shares the cache's items, limits and statistics, and is
+// safe for concurrent use.
+//
+// Each value is encoded on its own, so gob's type information is repeated
+// in every stored value. As with any use of gob, concrete types stored in
+// interface-typed fields must be registered with gob.Register before they
+// are encoded or decoded.
+type GobCache struct {
+	cache *Cache
+}
+
+// Gob returns a GobCache view of the cache.
+func (c *Cache) Gob() *GobCache {
+	return &GobCache{cache: c}
+}
+
+// Set gob-encodes v and stores it under key, replacing any existing item.
+// It returns the error if v cannot be encoded, in which case the cache is
+// left unchanged.
+func (g *GobCache) Set(key string, v any) error {
+	return g.SetWithTTL(key, v, 0)
+}
+
+// SetWithTTL is like Set, but the stored item expires after ttl. A zero
+// or negative ttl means the item never expires.
+func (g *GobCache) SetWithTTL(key string, v any, ttl time.Duration) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	g.cache.SetWithTTL(key, buf.Bytes(), ttl)
+	return nil
+}
+
+// Get decodes the value stored under key into into, which must be a
+// pointer, and reports whether the key was found. If the stored value
+// cannot be decoded into into, Get returns false and the decoding error.
+func (g *GobCache) Get(key string, into any) (bool, error) {
+	value, found := g.cache.Get(key)
+	if !found {
+		return false, nil
+	}
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(into); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete removes an item from the cache.
+func (g *GobCache) Delete(key string) {
+	g.cache.Delete(key)
+}
@@ -0,0 +1,140 @@
+package infux
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// KeyHandle gives access to the item of a single key, hashing the key only
+// once, when Key creates the handle, rather than on every call: it keeps
+// the key's hash and shard. It suits tight loops touching the same key
+// over and over, such as a Get followed by a conditional Set. The handle
+// stays valid for the cache's lifetime; after a Resize, its first call
+// finds the key's new shard from the hash it kept. A KeyHandle is safe for
+// concurrent use.
+//
+// Operations through a handle behave like the Cache methods of the same
+// name, except that Get does not consult bloom filters, and that features
+// needing more than the key's shard, namely Config.RefreshThreshold for
+// Get and Config.SkipEqualWrites for Set, make those calls fall back to
+// the Cache methods, hashing the key as usual.
+type KeyHandle struct {
+	c     *Cache
+	key   string
+	hash  uint64
+	shard atomic.Pointer[cacheShard]
+}
+
+// Key returns a handle on the item stored under key.
+func (c *Cache) Key(key string) *KeyHandle {
+	key = c.normalize(key)
+	h := &KeyHandle{c: c, key: key, hash: c.hash(key)}
+	h.shard.Store(c.table().shardFor(h.hash))
+	return h
+}
+
+// Key returns the key of the handle, as normalized by
+// Config.KeyNormalizer.
+func (h *KeyHandle) Key() string {
+	return h.key
+}
+
+// lock write-locks and returns the key's shard, first finding its new
+// shard if a Resize moved the one the handle kept.
+func (h *KeyHandle) lock() *cacheShard {
+	for {
+		shard := h.shard.Load()
+		shard.mu.Lock()
+		if !shard.moved {
+			return shard
+		}
+		shard.mu.Unlock()
+		h.shard.Store(h.c.table().shardFor(h.hash))
+	}
+}
+
+// lockLookup is like lock, but locks the shard with Cache.lockLookup, and
+// also returns its result.
+func (h *KeyHandle) lockLookup() (*cacheShard, bool) {
+	for {
+		shard := h.shard.Load()
+		write := h.c.lockLookup(shard)
+		if !shard.moved {
+			return shard, write
+		}
+		h.c.unlockLookup(shard, write)
+		h.shard.Store(h.c.table().shardFor(h.hash))
+	}
+}
+
+// record records the duration of an operation started at start with
+// Config.TrackLatency.
+func (h *KeyHandle) record(stripes *[latencyStripes]latencyHistogram, start time.Time) {
+	stripes[h.hash%latencyStripes].record(time.Since(start))
+}
+
+// Get retrieves the item, like Cache.Get.
+func (h *KeyHandle) Get() ([]byte, bool) {
+	c := h.c
+	if c.refreshThreshold > 0 {
+		return c.Get(h.key)
+	}
+	if c.latency != nil {
+		defer h.record(&c.latency.get, time.Now())
+	}
+	if c.hot != nil {
+		c.hot[h.hash%hotKeyStripes].record(h.key)
+	}
+	shard, write := h.lockLookup()
+	e, found := c.lookupLocked(shard, h.key, write)
+	if found {
+		e = e.pinned()
+	}
+	stale := !found && c.expiredLocked(shard, h.key, write)
+	c.unlockLookup(shard, write)
+	if found {
+		return c.valueOut(e), true
+	}
+	if stale {
+		c.deleteIfExpired(h.key)
+	}
+	if c.loader == nil {
+		return nil, false
+	}
+	value, err := c.load(h.key)
+	return c.copyOut(value), err == nil
+}
+
+// Set stores value as the item, replacing any existing item, like
+// Cache.Set. The item never expires.
+func (h *KeyHandle) Set(value []byte) {
+	c := h.c
+	if c.skipEqualWrites {
+		c.Set(h.key, value)
+		return
+	}
+	if c.latency != nil {
+		defer h.record(&c.latency.set, time.Now())
+	}
+	if c.writeErr() != nil {
+		return
+	}
+	e := c.newEntry(h.key, value)
+	shard := h.lock()
+	c.insertLocked(shard, e)
+	c.unlock(shard)
+	c.evictOverflow(shard)
+}
+
+// Delete removes the item, like Cache.Delete.
+func (h *KeyHandle) Delete() {
+	c := h.c
+	if c.writeErr() != nil {
+		return
+	}
+	shard := h.lock()
+	defer c.unlock(shard)
+	if e, found := shard.items[h.key]; found {
+		c.deleteLocked(shard, e)
+	}
+}
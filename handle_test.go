@@ -0,0 +1,62 @@
+package infux
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeyHandle(t *testing.T) {
+	c := NewWithConfig(Config{Shards: 4, KeyNormalizer: strings.ToLower})
+	h := c.Key("User:1")
+	if h.Key() != "user:1" {
+		t.Fatalf("Key() = %q, want the normalized key", h.Key())
+	}
+	if _, found := h.Get(); found {
+		t.Fatal("Get found a missing key")
+	}
+	h.Set([]byte("v"))
+	if v, found := c.Get("USER:1"); !found || string(v) != "v" {
+		t.Fatalf("Cache.Get = %q, %v after KeyHandle.Set", v, found)
+	}
+	if err := c.Resize(64); err != nil {
+		t.Fatal(err)
+	}
+	if v, found := h.Get(); !found || string(v) != "v" {
+		t.Fatalf("Get = %q, %v after Resize", v, found)
+	}
+	h.Set([]byte("w"))
+	if v, _ := c.Get("user:1"); string(v) != "w" {
+		t.Fatalf("Cache.Get = %q after a Set through the handle following Resize", v)
+	}
+	if h.shard.Load() != c.getShard("user:1") {
+		t.Fatal("handle kept the shard from before Resize")
+	}
+	h.Delete()
+	if c.Has("user:1") {
+		t.Fatal("key present after KeyHandle.Delete")
+	}
+}
+
+// BenchmarkGetThenSet measures a Get followed by a Set of the same long
+// key, through the Cache, which hashes the key twice, and through a
+// KeyHandle, which hashed it once when created.
+func BenchmarkGetThenSet(b *testing.B) {
+	key := strings.Repeat("tenant:session:", 8)
+	value := []byte("v")
+	b.Run("Cache", func(b *testing.B) {
+		c := New()
+		for i := 0; i < b.N; i++ {
+			if _, found := c.Get(key); !found || i%2 == 0 {
+				c.Set(key, value)
+			}
+		}
+	})
+	b.Run("KeyHandle", func(b *testing.B) {
+		h := New().Key(key)
+		for i := 0; i < b.N; i++ {
+			if _, found := h.Get(); !found || i%2 == 0 {
+				h.Set(value)
+			}
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package infux
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// hotKeyStripes is the number of independently locked trackers of a
+// cache's hot keys. A key is always counted by the same tracker, chosen
+// by its hash.
+const hotKeyStripes = 16
+
+// KeyCount is the estimated access count of a key, as returned by
+// HotKeys.
+type KeyCount struct {
+	Key string
+	// Count is an upper bound of the number of lookups of the key.
+	Count uint64
+	// Error is the most Count may overestimate the number of lookups by:
+	// the key was looked up at least Count-Error times.
+	Error uint64
+}
+
+// hotKeys tracks the most looked up keys of one stripe with the
+// space-saving algorithm: it counts at most its capacity of keys, and a
+// key it does not count replaces the one with the lowest count, taking
+// over that count plus one. Keys looked up more often than 1/capacity of
+// the time are guaranteed to be counted.
+type hotKeys struct {
+	mu       sync.Mutex
+	capacity int
+	counts   map[string]*KeyCount
+	// heap is a min-heap of the counted keys by count.
+	heap countHeap
+}
+
+// countHeap is a min-heap of key counts, implementing heap.Interface.
+type countHeap struct {
+	items []*KeyCount
+	// index maps each counted key to its position in items.
+	index map[*KeyCount]int
+}
+
+func (h *countHeap) Len() int           { return len(h.items) }
+func (h *countHeap) Less(i, j int) bool { return h.items[i].Count < h.items[j].Count }
+
+func (h *countHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.index[h.items[i]] = i
+	h.index[h.items[j]] = j
+}
+
+func (h *countHeap) Push(x any) {
+	h.index[x.(*KeyCount)] = len(h.items)
+	h.items = append(h.items, x.(*KeyCount))
+}
+
+func (h *countHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	delete(h.index, last)
+	return last
+}
+
+// newHotKeys returns a tracker counting up to capacity keys.
+func newHotKeys(capacity int) *hotKeys {
+	return &hotKeys{
+		capacity: capacity,
+		counts:   make(map[string]*KeyCount, capacity),
+		heap:     countHeap{index: make(map[*KeyCount]int, capacity)},
+	}
+}
+
+// record counts a lookup of key.
+func (h *hotKeys) record(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if kc, ok := h.counts[key]; ok {
+		kc.Count++
+		heap.Fix(&h.heap, h.heap.index[kc])
+		return
+	}
+	if len(h.counts) < h.capacity {
+		kc := &KeyCount{Key: key, Count: 1}
+		h.counts[key] = kc
+		heap.Push(&h.heap, kc)
+		return
+	}
+	// Replace the least counted key, reusing its record.
+	kc := h.heap.items[0]
+	delete(h.counts, kc.Key)
+	kc.Key, kc.Error = key, kc.Count
+	kc.Count++
+	h.counts[key] = kc
+	heap.Fix(&h.heap, 0)
+}
+
+// recordLookup counts a lookup of key for HotKeys, if enabled.
+func (c *Cache) recordLookup(key string) {
+	if c.hot != nil {
+		c.hot[c.hash(key)%hotKeyStripes].record(key)
+	}
+}
+
+// HotKeys returns the most looked up keys with Config.TrackHotKeys,
+// with the most looked up first, or nil if hot key tracking is
+// disabled. The counts are estimates from a bounded-memory heavy
+// hitters algorithm; see KeyCount. Every lookup through Get, GetString,
+// GetReader, Has, GetOrCompute and GetContext is counted, whether it
+// hits or misses, since the cache was created. Keys that are looked up
+// rarely may be missing or have imprecise counts, but frequently looked
+// up keys are found reliably.
+func (c *Cache) HotKeys() []KeyCount {
+	if c.hot == nil {
+		return nil
+	}
+	var all []KeyCount
+	for _, h := range c.hot {
+		h.mu.Lock()
+		for _, kc := range h.heap.items {
+			all = append(all, *kc)
+		}
+		h.mu.Unlock()
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Count > all[j].Count })
+	if len(all) > c.hotKeys {
+		all = all[:c.hotKeys]
+	}
+	return all
+}
@@ -0,0 +1,57 @@
+package infux
+
+import "sync/atomic"
+
+// member is the record of a live entry in the membership index. Its
+// expiry mirrors the entry's, so that Has can check it without the shard
+// lock.
+type member struct {
+	expiresAt atomic.Int64
+}
+
+// indexLocked adds e, which is being stored in its shard, to the
+// membership index, if the cache has one. The caller must hold the
+// shard's write lock.
+func (c *Cache) indexLocked(e *entry) {
+	if c.index == nil {
+		return
+	}
+	e.member = &member{}
+	e.member.expiresAt.Store(e.deadline())
+	c.index.Store(e.key, e.member)
+}
+
+// unindexLocked removes e, which is being removed from its shard, from
+// the membership index, unless a newer entry for its key has replaced it
+// there. The caller must hold the shard's write lock.
+func (c *Cache) unindexLocked(e *entry) {
+	if e.member != nil {
+		c.index.CompareAndDelete(e.key, e.member)
+	}
+}
+
+// reindexLocked updates the membership index after the expiry of e has
+// changed. The caller must hold the shard's write lock.
+func (c *Cache) reindexLocked(e *entry) {
+	c.markDirty()
+	if e.member != nil {
+		e.member.expiresAt.Store(e.deadline())
+	}
+}
+
+// hasIndexed implements Has with the membership index.
+func (c *Cache) hasIndexed(key string) bool {
+	c.recordLookup(key)
+	v, found := c.index.Load(key)
+	if found {
+		if expiresAt := v.(*member).expiresAt.Load(); expiresAt == 0 || c.now() < expiresAt {
+			c.getShard(key).stats.hits.Add(1)
+			return true
+		}
+	}
+	c.getShard(key).stats.misses.Add(1)
+	if found {
+		c.deleteIfExpired(key)
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package infux
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMembershipIndexFollowsWrites(t *testing.T) {
+	c, clk := newTestCache(Config{Shards: 1, MaxEntries: 2, MembershipIndex: true})
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+	if !c.Has("a") || !c.Has("b") {
+		t.Fatal("Has = false for stored keys")
+	}
+	c.Delete("a")
+	if c.Has("a") {
+		t.Fatal("Has = true for a deleted key")
+	}
+	c.Set("c", []byte("3"))
+	c.Set("d", []byte("4"))
+	if c.Has("b") {
+		t.Fatal("Has = true for an evicted key")
+	}
+	c.SetWithTTL("c", []byte("3"), time.Minute)
+	clk.Advance(30 * time.Second)
+	c.Touch("c", time.Minute)
+	clk.Advance(45 * time.Second)
+	if !c.Has("c") {
+		t.Fatal("Has ignored the expiry extended by Touch")
+	}
+	c.Clear()
+	if c.Has("c") || c.Has("d") {
+		t.Fatal("Has = true after Clear")
+	}
+}
+
+// BenchmarkHasUnderWrites measures parallel Has calls while another
+// goroutine keeps writing to the same shards, with and without the
+// membership index.
+func BenchmarkHasUnderWrites(b *testing.B) {
+	for _, indexed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("MembershipIndex=%v", indexed), func(b *testing.B) {
+			c := NewWithConfig(Config{Shards: 4, MembershipIndex: indexed})
+			keys := make([]string, 1<<10)
+			for i := range keys {
+				keys[i] = fmt.Sprint(i)
+				c.Set(keys[i], []byte("v"))
+			}
+			stop, done := make(chan struct{}), make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+						c.Set(keys[i%len(keys)], []byte("v"))
+					}
+				}
+			}()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					c.Has(keys[i%len(keys)])
+				}
+			})
+			b.StopTimer()
+			close(stop)
+			<-done
+		})
+	}
+}
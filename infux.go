@@ -3,88 +3,1052 @@
 package infux
 
 import (
-	"hash/fnv"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// The number of shards to use for the cache.
+// The default number of shards to use for the cache.
 // This is set to 256 to provide a good balance of concurrency
-// and memory overhead. A power of two is generally a good choice.
-const shardCount = 256
+// and memory overhead. It must be a power of two.
+const defaultShardCount = 256
 
 // Cache is a thread-safe, high-performance in-memory cache.
+//
+// A Cache must be closed with Close once it is no longer needed if it
+// was created with options that start background goroutines.
+//
+// When Config.MaxEntries, Config.MaxBytes or Config.MaxCost is set, each
+// limit applies to the cache as a whole, but recency is tracked per
+// shard, so eviction is an approximate LRU: a write that pushes the cache
+// over a limit evicts the least recently used entries of the shard being
+// written to. If that shard has no other entry, the least recently used
+// entries of other shards are evicted instead. Recency is never compared
+// across shards.
 type Cache struct {
-	shards [shardCount]*cacheShard
+	// cfg is the configuration the cache was created with, with Shards
+	// set to the initial shard count.
+	cfg Config
+
+	// tab holds the shards. It is replaced as a whole by Resize.
+	tab atomic.Pointer[shardTable]
+	// resizing serializes calls to Resize.
+	resizing sync.Mutex
+	// retired holds the operation counters of shards replaced by Resize.
+	retired shardStats
+	// hash hashes keys to select their shard.
+	hash func(string) uint64
+	// normalizeKey maps keys to the form they are stored under, or is
+	// nil if keys are stored as given.
+	normalizeKey func(key string) string
+	// clock tells the time for expiry.
+	clock clock
+	// bloomKeys is the number of keys the shards' bloom filters are sized
+	// for, or 0 if lookups do not use bloom filters.
+	bloomKeys int
+	// subs are the subscribers' channels by key, guarded by subMu, and
+	// subscribers counts them so that writes can skip publishing when
+	// there are none.
+	subMu       sync.RWMutex
+	subs        map[string][]chan Event
+	subscribers atomic.Int64
+	// hot tracks the most looked up keys by stripe, and hotKeys is the
+	// number of keys HotKeys reports, if Config.TrackHotKeys is set.
+	hot     []*hotKeys
+	hotKeys int
+	// tags indexes the items stored with SetWithTags.
+	tags tagIndex
+	// latency records the durations of Get and Set calls, if
+	// Config.TrackLatency is set.
+	latency *latencyRecorder
+	// trackAccess is set if entries record their lookup hits, for Meta.
+	trackAccess bool
+	// churn remembers recent evictions, if Config.TrackEvictionChurn is
+	// set.
+	churn *churnTracker
+	// index maps the key of every stored entry to its member record, or
+	// is nil if the cache has no membership index.
+	index *sync.Map
+
+	// maxEntries, maxBytes and maxCost are the global entry, byte and
+	// cost limits, or 0 if unlimited; SetLimits may change them at any
+	// time. bounded is set if any limit is, including maxShardEntries, in
+	// which case the LRU lists are maintained, count tracks the number of
+	// entries and cost their total cost.
+	maxEntries atomic.Int64
+	maxBytes   atomic.Int64
+	maxCost    atomic.Int64
+	// maxShardEntries is the entry limit of each shard, or 0.
+	maxShardEntries int
+	// maxValueBytes is the largest value length accepted, or 0.
+	maxValueBytes int
+	bounded       bool
+	// maxEvictions bounds the evictions of a write while draining is set,
+	// which it is from when limits are lowered below the cache's contents
+	// until the cache is found back within them.
+	maxEvictions int
+	draining     atomic.Bool
+	count        atomic.Int64
+	cost         atomic.Int64
+	// policy selects which entries are evicted to respect the limits.
+	policy EvictionPolicy
+
+	// onEvict is called for entries that leave the cache without being
+	// deleted explicitly, or nil.
+	onEvict func(key string, value []byte, reason EvictReason)
+	// onEvictBatch is called with batches of such entries instead, or is
+	// nil.
+	onEvictBatch func(entries []Entry, reason EvictReason)
+
+	// loader loads missing items on Get, or is nil.
+	loader func(key string) ([]byte, error)
+	// breaker is the circuit breaker in front of loader, or nil.
+	breaker *loaderBreaker
+	// negativeTTL is how long a key reported missing by the loader or a
+	// compute function is remembered as missing, or 0.
+	negativeTTL time.Duration
+	// refreshThreshold is the remaining time-to-live below which Get
+	// refreshes an item through the loader, or 0. refreshing holds the
+	// keys being refreshed.
+	refreshThreshold time.Duration
+	refreshing       sync.Map
+
+	// copyOnGet and copyOnSet make reads return, and writes store,
+	// private copies of values.
+	copyOnGet bool
+	copyOnSet bool
+	// logger receives the records of significant events.
+	logger *slog.Logger
+	// verifyChecksums makes lookups check values against their checksums.
+	verifyChecksums bool
+	// pooled is set if values are copied into pooled buffers, with
+	// Config.PooledValues.
+	pooled bool
+	// sketch counts key uses for TinyLFU admission, or is nil.
+	sketch *frequencySketch
+	// compactMaps makes the sweeper compact sparse shard maps, and
+	// shardCapacity is the number of items each shard's map was
+	// preallocated for with Config.InitialCapacity, or 0.
+	compactMaps   bool
+	shardCapacity int
+	// bucketWidth is the length of an expiry window in nanoseconds with
+	// Config.BucketedExpiry, or 0.
+	bucketWidth int64
+	// spinLocks makes shard locks spin before blocking, with
+	// Config.SpinBeforeBlock on more than one CPU.
+	spinLocks bool
+	// tracer receives the spans of GetCtx and SetCtx, or is nil, and
+	// hashTraceKeys hides their keys.
+	tracer        Tracer
+	hashTraceKeys bool
+	// persist tracks changes for Config.Persist, or is nil.
+	persist *persister
+	// arena holds the copies of stored values with Config.Arena, or is
+	// nil.
+	arena *valueArena
+	// compressor compresses stored values, or is nil.
+	compressor Compressor
+
+	// sliding is set in sliding expiration mode, where lookups extend
+	// the expiry of the items they find.
+	sliding bool
+	// ttlJitter is the maximum random offset applied to expiry times set
+	// from a TTL, or 0.
+	ttlJitter time.Duration
+	// ordered is set if the cache is bounded and keeps its entries in the
+	// shards' LRU lists, which is unless it uses sampled eviction.
+	ordered bool
+	// sampled is the number of entries compared to choose each victim with
+	// sampled eviction, or 0 if eviction follows the LRU lists.
+	sampled int
+	// lookupWrites is set if lookups mutate entries, and therefore need
+	// the shard's write lock.
+	lookupWrites bool
+	// skipEqualWrites is set if writes of an unchanged value only update
+	// the existing item's expiry.
+	skipEqualWrites bool
+	// recencySampleRate is the fraction of lookups that update the LRU
+	// list, or 0 if all of them do.
+	recencySampleRate float64
+	// size is the total length of all keys and values in the cache.
+	size atomic.Int64
+	// valueSize is the total length of all values in the cache, and
+	// maxValue the length of the largest value stored since the cache was
+	// created or last cleared.
+	valueSize atomic.Int64
+	maxValue  atomic.Int64
+
+	// evictCursor rotates the first shard tried by evictOthers so that
+	// overflow is not always taken from the same shards.
+	evictCursor atomic.Uint32
+
+	// frozen is set while writes are rejected, between Freeze and
+	// Unfreeze.
+	frozen atomic.Bool
+	// closed is set once Close has been called. done is closed at the
+	// same time to signal background workers, which are tracked by wg.
+	closed atomic.Bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+	// starting serializes the start of tasks by startTask with Close, so
+	// that none is added to wg once Close waits for it.
+	starting sync.Mutex
 }
 
-// cacheShard is a single shard of the cache. It contains a map of key-value
-// pairs and a read-write mutex to protect access to the map.
+// cacheShard is a single shard of the cache. It contains a map of keys to
+// entries and a read-write mutex to protect access to the map.
 type cacheShard struct {
-	items map[string][]byte
-	mu    sync.RWMutex
+	items map[string]*entry
+	lru   lruList
+	// size is the total length of the shard's keys and values. It is
+	// guarded by mu and mirrored into the cache-wide total.
+	size int64
+	// valueSize is the total length of the shard's values, guarded by mu
+	// and mirrored into the cache-wide total.
+	valueSize int64
+	// moved is set, under mu, once Resize has moved the shard's items to
+	// a new shard table. Operations that locked a moved shard must look
+	// up their key's shard again.
+	moved bool
+	// bloom is the shard's bloom filter of written keys, or nil if the
+	// cache has none. It is read without locking, and replaced as a whole
+	// when it is rebuilt.
+	bloom atomic.Pointer[bloomFilter]
+	// length mirrors len(items), so that Len can read it without
+	// locking. It is only written under mu.
+	length atomic.Int64
+	// peak is the largest number of entries items has held since it was
+	// allocated, which its memory is sized for. It is guarded by mu.
+	peak int
+	// accesses counts hits since the shard's LFU counters were last
+	// aged. It is guarded by mu.
+	accesses int
+	mu       shardMutex
+	stats    shardStats
+	// flight coalesces concurrent computations of missing keys.
+	flight flightGroup
+	// negative maps keys known to be missing from the backing store to
+	// the Unix nanosecond time their tombstone expires. It is allocated
+	// on first use and guarded by mu.
+	negative map[string]int64
+	// evicted holds entries removed by the current write operation that
+	// must be reported to the OnEvict callback once the lock is released.
+	// It is guarded by mu and only used when a callback is configured.
+	evicted []eviction
+	// capture, if set by SetMultiReturningEvicted, collects the keys of
+	// the entries evicted to respect the limits while it holds mu.
+	capture *[]string
+	// buckets maps expiry windows to the keys filed in their buckets with
+	// Config.BucketedExpiry, and swept is the latest window a sweep has
+	// visited. Both are guarded by mu.
+	buckets map[int64][]string
+	swept   int64
+}
+
+// entry is a single cached value together with its metadata.
+type entry struct {
+	key   string
+	value []byte
+	// expiresAt is the expiry time in Unix nanoseconds, or 0 if the
+	// entry never expires.
+	expiresAt int64
+	// writtenAt is the time the entry was stored, in Unix nanoseconds.
+	writtenAt int64
+	// ttl is the time-to-live the entry was written with, or 0. It is
+	// used to extend expiresAt on access in sliding expiration mode.
+	ttl time.Duration
+	// prev and next link the entry into its shard's LRU list, which is in
+	// insertion order with PolicyFIFO. They are only used when the cache
+	// has an entry or byte limit.
+	prev, next *entry
+	// freq is the entry's aged access count, used by PolicyLFU. It is
+	// updated atomically because with sampled eviction, lookups update it
+	// under the shard's read lock.
+	freq atomic.Uint32
+	// atime is the time of the entry's most recent write or, except with
+	// PolicyFIFO, access, in Unix nanoseconds. It is only maintained with
+	// sampled eviction, where lookups update it under the read lock.
+	atime atomic.Int64
+	// accessedAt is the time of the entry's most recent lookup hit, in
+	// Unix nanoseconds, or 0, and hits the number of those hits. They are
+	// only maintained with Config.TrackAccess.
+	accessedAt atomic.Int64
+	hits       atomic.Uint64
+	// maxIdle is the idle time after which the entry expires, as set by
+	// SetWithMaxIdle, or 0, and usedAt the time of its most recent write
+	// or lookup hit, in Unix nanoseconds, while maxIdle is set. usedAt is
+	// updated atomically, by lookups under the shard's read lock.
+	maxIdle time.Duration
+	usedAt  atomic.Int64
+	// tags are the tags set by SetWithTags, if any.
+	tags []string
+	// cost is the cost set by SetWithCost, or 0 for the default cost.
+	cost int64
+	// compressed is set if value holds the value compressed by the
+	// cache's Compressor.
+	compressed bool
+	// pool is the pooled buffer holding value, with Config.PooledValues,
+	// or nil. The entry holds one of its references while stored.
+	pool *pooledValue
+	// sum is the checksum of value, with Config.VerifyChecksums.
+	sum uint32
+	// member is the entry's record in the membership index while it is
+	// stored, or nil if the cache has no index.
+	member *member
+	// bucket is one more than the expiry window of the earliest bucket
+	// the entry is filed in with Config.BucketedExpiry, or 0. It is
+	// guarded by the shard's lock.
+	bucket int64
+}
+
+// size returns the number of bytes accounted for e: the length of its key
+// and value.
+func (e *entry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+// expired reports whether the entry has expired at the given time,
+// expressed in Unix nanoseconds.
+func (e *entry) expired(now int64) bool {
+	at := e.deadline()
+	return at != 0 && now >= at
 }
 
-// New creates and returns a new Cache instance.
+// New creates and returns a new Cache instance with the default
+// number of shards. It starts no goroutines: expired items are removed
+// lazily, see Config.CleanupInterval.
 func New() *Cache {
-	c := &Cache{}
-	for i := 0; i < shardCount; i++ {
-		c.shards[i] = &cacheShard{
-			items: make(map[string][]byte),
-		}
+	return newCache(defaultShardCount)
+}
+
+// NewWithShards creates and returns a new Cache instance with n shards.
+// Fewer shards save memory for small caches, while more shards reduce
+// lock contention for large, heavily concurrent ones.
+// It panics if n is not a positive power of two.
+func NewWithShards(n int) *Cache {
+	if !isPowerOfTwo(n) {
+		panic(fmt.Sprintf("infux: shard count must be a positive power of two, got %d", n))
 	}
+	return newCache(n)
+}
+
+// newCache creates a cache with n shards. n must be a power of two.
+func newCache(n int) *Cache {
+	c := &Cache{}
+	c.init(n)
 	return c
 }
 
-// getShard returns the cache shard for a given key.
-// It uses the FNV-1a hash algorithm to distribute keys evenly across shards.
+// init sets up c, a zero Cache, with n shards and the default
+// configuration. n must be a power of two.
+func (c *Cache) init(n int) {
+	c.cfg = Config{Shards: n}
+	c.tab.Store(newShardTable(n, false))
+	c.hash = defaultHash
+	c.clock = realClock{}
+	c.logger = slog.Default()
+	c.done = make(chan struct{})
+}
+
+// newShard creates an empty shard, whose lock spins before blocking if
+// spin is set.
+func newShard(spin bool) *cacheShard {
+	s := &cacheShard{items: make(map[string]*entry)}
+	s.mu.spin = spin
+	s.lru.init()
+	return s
+}
+
+// reset drops every entry in the shard. The caller must hold the write
+// lock.
+func (s *cacheShard) reset() {
+	s.items = make(map[string]*entry)
+	s.peak = 0
+	s.lru.init()
+	s.size = 0
+	s.valueSize = 0
+	s.length.Store(0)
+	s.accesses = 0
+	s.negative = nil
+	s.buckets = nil
+}
+
+// isPowerOfTwo reports whether n is a positive power of two.
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// hashKey hashes key with the 64-bit FNV-1a algorithm, which distributes
+// keys evenly across shards. It is an inlined equivalent of hash/fnv's
+// New64a that works on the string directly, so it allocates neither a
+// hasher nor a []byte copy of the key.
+func hashKey(key string) uint64 {
+	h := uint64(fnvOffset64)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= fnvPrime64
+	}
+	// Shards are selected by the low bits, which the multiplications
+	// leave depending on the low bits of the key's bytes only, so fold
+	// the better mixed high half into them.
+	return h ^ h>>32
+}
+
+// defaultHash is the shard hash used when Config.HashFunc is not set.
+func defaultHash(key string) uint64 {
+	return hashKey(key)
+}
+
+// normalize returns the key under which key is stored, as given by
+// Config.KeyNormalizer.
+func (c *Cache) normalize(key string) string {
+	if c.normalizeKey == nil {
+		return key
+	}
+	return c.normalizeKey(key)
+}
+
+// normalizeAll returns the normalized forms of keys.
+func (c *Cache) normalizeAll(keys []string) []string {
+	normalized := make([]string, len(keys))
+	for i, key := range keys {
+		normalized[i] = c.normalize(key)
+	}
+	return normalized
+}
+
+// getShard returns the cache shard for a given key. Unless the caller
+// locks it with lockShard or a variant, the shard may have been moved by
+// Resize.
 func (c *Cache) getShard(key string) *cacheShard {
-	hasher := fnv.New32a()
-	hasher.Write([]byte(key))
-	return c.shards[hasher.Sum32()&(shardCount-1)]
+	return c.table().shardFor(c.hash(key))
+}
+
+// ShardIndex returns the index of the shard that key belongs to, in the
+// order of ShardStats, for example to construct keys that share a shard
+// in tests of contention or eviction. Keys with the same index are
+// guarded by the same lock. The index is only stable until the next
+// Resize.
+func (c *Cache) ShardIndex(key string) int {
+	return int(c.hash(c.normalize(key)) & c.table().mask)
 }
 
 // Set adds an item to the cache, replacing any existing item.
 // The key must be a string and the value is a byte slice.
+// The item never expires. Set is a no-op on a closed cache.
 func (c *Cache) Set(key string, value []byte) {
-	shard := c.getShard(key)
-	shard.mu.Lock()
-	defer shard.mu.Unlock()
-	shard.items[key] = value
+	key = c.normalize(key)
+	if c.latency != nil {
+		defer c.recordLatency(&c.latency.set, key, time.Now())
+	}
+	if c.skipEqualWrite(key, value, 0) {
+		return
+	}
+	c.set(c.newEntry(key, value))
+}
+
+// TrySet is like Set, but reports why the item could not be stored: it
+// returns ErrTooLarge if the value exceeds Config.MaxValueBytes, or if the
+// item on its own exceeds MaxBytes or MaxCost, ErrClosed on a closed
+// cache and ErrFrozen on a frozen one.
+func (c *Cache) TrySet(key string, value []byte) error {
+	key = c.normalize(key)
+	if c.latency != nil {
+		defer c.recordLatency(&c.latency.set, key, time.Now())
+	}
+	if c.skipEqualWrite(key, value, 0) {
+		return nil
+	}
+	return c.set(c.newEntry(key, value))
+}
+
+// TrySetTimeout is like Set, but gives up if it cannot lock the key's
+// shard within d, so that a shard held by other goroutines for long does
+// not stall the caller past its latency budget. It reports whether the
+// item was stored, which it also is not for the reasons TrySet returns an
+// error for. The lock is polled with backoff rather than queued for,
+// which costs some latency over Set under contention and lets waiting
+// Set calls, which keep blocking until they get the lock, go first.
+// Config.SkipEqualWrites does not apply.
+func (c *Cache) TrySetTimeout(key string, value []byte, d time.Duration) bool {
+	key = c.normalize(key)
+	if c.writeErr() != nil {
+		return false
+	}
+	e := c.newEntry(key, value)
+	shard, ok := c.tryLockShard(key, time.Now().Add(d))
+	if !ok {
+		return false
+	}
+	stored := c.insertLocked(shard, e)
+	c.unlock(shard)
+	c.evictOverflow(shard)
+	return stored
+}
+
+// set stores e, evicting other entries if the cache is over its limits.
+func (c *Cache) set(e *entry) error {
+	_, err := c.replace(e)
+	return err
+}
+
+// replace is like set, but also reports whether e replaced a live item.
+func (c *Cache) replace(e *entry) (bool, error) {
+	if err := c.writeErr(); err != nil {
+		return false, err
+	}
+	shard := c.lockShard(e.key)
+	_, replaced := c.liveLocked(shard, e.key)
+	stored := c.insertLocked(shard, e)
+	c.unlock(shard)
+	c.evictOverflow(shard)
+	if !stored {
+		return false, ErrTooLarge
+	}
+	return replaced, nil
+}
+
+// skipEqualWrite implements Config.SkipEqualWrites for a write of value
+// under key that expires after ttl. If the key holds a live item with an
+// equal value, it gives the item the new expiry in place, as if the write
+// took place, and returns true; the caller then skips the write. The
+// values are first compared under the read lock, so that writes of
+// changed values only take the write lock for the actual write.
+func (c *Cache) skipEqualWrite(key string, value []byte, ttl time.Duration) bool {
+	if !c.skipEqualWrites || c.writeErr() != nil {
+		return false
+	}
+	return c.skipEqual(key, value, func(e *entry) {
+		e.setTTL(ttl, c.now())
+		c.jitter(e)
+	})
+}
+
+// skipEqualWriteAt is like skipEqualWrite, for a write of an item that
+// expires exactly at the Unix nanosecond time at, after ttl.
+func (c *Cache) skipEqualWriteAt(key string, value []byte, ttl time.Duration, at int64) bool {
+	if !c.skipEqualWrites || c.writeErr() != nil {
+		return false
+	}
+	return c.skipEqual(key, value, func(e *entry) {
+		e.ttl, e.expiresAt = ttl, at
+	})
+}
+
+// skipEqual implements skipEqualWrite, giving the item its new expiry
+// with expire.
+func (c *Cache) skipEqual(key string, value []byte, expire func(e *entry)) bool {
+	shard := c.rlockShard(key)
+	old, found := c.liveLocked(shard, key)
+	equal := found && bytes.Equal(c.valueOf(old), value)
+	shard.mu.RUnlock()
+	if !equal {
+		return false
+	}
+	shard = c.lockShard(key)
+	defer c.unlock(shard)
+	if e, found := c.liveLocked(shard, key); !found || e != old {
+		// The item changed meanwhile, so the write must take place.
+		return false
+	}
+	expire(old)
+	c.reindexLocked(old)
+	c.scheduleLocked(shard, old)
+	if c.bounded {
+		c.accessLocked(shard, old)
+	}
+	shard.stats.sets.Add(1)
+	return true
+}
+
+// insertLocked stores e in shard as a new write and evicts other entries
+// of the shard if the cache is over its limits. It reports whether e was
+// stored, which it is not if it is too large for the limits. The caller
+// must hold the shard's write lock, and must call evictOverflow after
+// releasing it.
+func (c *Cache) insertLocked(shard *cacheShard, e *entry) bool {
+	if c.maxValueBytes > 0 && len(e.value) > c.maxValueBytes {
+		// Reject the write, leaving any existing item in place.
+		return false
+	}
+	if maxBytes, maxCost := c.maxBytes.Load(), c.maxCost.Load(); maxBytes > 0 && e.size() > maxBytes || maxCost > 0 && e.weight() > maxCost {
+		// The item can never fit, so storing it would only evict
+		// everything else. Drop it, along with the value it replaces.
+		if old, found := shard.items[e.key]; found {
+			c.evictLocked(shard, old, ReasonEvicted)
+		}
+		return false
+	}
+	if c.sketch != nil && !c.admitLocked(shard, e) {
+		return false
+	}
+	c.storeLocked(shard, e)
+	shard.stats.sets.Add(1)
+	budget := c.evictionBudget()
+	if budget >= 0 {
+		c.payLocked(shard, e)
+	}
+	c.shrinkLocked(shard, e, budget)
+	return true
+}
+
+// storeLocked inserts e into shard, replacing any existing entry with the
+// same key. The caller must hold the shard's write lock.
+func (c *Cache) storeLocked(shard *cacheShard, e *entry) {
+	e.writtenAt = c.now()
+	if c.verifyChecksums {
+		e.sum = checksum(e.value)
+	}
+	if old, found := shard.items[e.key]; found {
+		reason := ReasonReplaced
+		if old.expired(e.writtenAt) {
+			reason = ReasonExpired
+		} else {
+			// A new value for a popular key stays popular.
+			e.freq.Store(old.freq.Load())
+		}
+		c.evictLocked(shard, old, reason)
+	} else if c.churn != nil {
+		c.churn.stored(e.key)
+	}
+	shard.items[e.key] = e
+	shard.length.Add(1)
+	shard.peak = max(shard.peak, len(shard.items))
+	c.markDirty()
+	c.scheduleLocked(shard, e)
+	c.bloomAddLocked(shard, e.key)
+	c.indexLocked(e)
+	c.tagLocked(e)
+	c.publish(EventSet, e.key)
+	if shard.negative != nil {
+		delete(shard.negative, e.key)
+	}
+	shard.size += e.size()
+	c.size.Add(e.size())
+	shard.valueSize += int64(len(e.value))
+	c.valueSize.Add(int64(len(e.value)))
+	for n := int64(len(e.value)); ; {
+		largest := c.maxValue.Load()
+		if n <= largest || c.maxValue.CompareAndSwap(largest, n) {
+			break
+		}
+	}
+	if c.sampled > 0 {
+		e.atime.Store(e.writtenAt)
+	}
+	if c.bounded {
+		if c.ordered {
+			shard.lru.pushFront(e)
+		}
+		c.count.Add(1)
+		c.cost.Add(e.weight())
+	}
+}
+
+// removeLocked removes e from shard. The caller must hold the shard's
+// write lock.
+func (c *Cache) removeLocked(shard *cacheShard, e *entry) {
+	if e.pool != nil {
+		e.pool.release()
+	}
+	delete(shard.items, e.key)
+	shard.length.Add(-1)
+	c.markDirty()
+	c.unindexLocked(e)
+	c.untagLocked(e)
+	shard.size -= e.size()
+	c.size.Add(-e.size())
+	shard.valueSize -= int64(len(e.value))
+	c.valueSize.Add(-int64(len(e.value)))
+	if c.bounded {
+		if c.ordered {
+			shard.lru.remove(e)
+		}
+		c.count.Add(-1)
+		c.cost.Add(-e.weight())
+	}
+}
+
+// deleteLocked removes e from shard as an explicit delete. The caller
+// must hold the shard's write lock.
+func (c *Cache) deleteLocked(shard *cacheShard, e *entry) {
+	c.removeLocked(shard, e)
+	shard.stats.deletes.Add(1)
+	c.publish(EventDelete, e.key)
 }
 
 // Get retrieves an item from the cache.
 // It returns the value as a byte slice and a boolean indicating
-// whether the key was found.
+// whether the key was found. Expired items are reported as not found,
+// and removed on the spot, triggering OnEvict with ReasonExpired.
+// When the cache has an entry or byte limit, Get marks the item as
+// recently used. In sliding expiration mode, Get also extends the item's
+// expiry by its TTL. If the cache has a Loader, a miss is loaded through
+// it; see Config.Loader. A hit on an item about to expire may also start
+// a background refresh; see Config.RefreshThreshold.
 func (c *Cache) Get(key string) ([]byte, bool) {
-	shard := c.getShard(key)
+	key = c.normalize(key)
+	if c.latency != nil {
+		defer c.recordLatency(&c.latency.get, key, time.Now())
+	}
+	if e, found := c.lookup(key); found {
+		return c.valueOut(e), true
+	}
+	if c.loader == nil {
+		return nil, false
+	}
+	value, err := c.load(key)
+	return c.copyOut(value), err == nil
+}
+
+// GetErr is like Get, but reports a miss with an error rather than a
+// bool, for call sites that already return errors: ErrNotFound if the key
+// is missing or expired and no Loader is configured, or else the error
+// the load failed with: the Loader's own error, returned unchanged, or an
+// error wrapping ErrCircuitOpen or ErrPanicked, or ErrClosed. All of them
+// can be matched with errors.Is.
+func (c *Cache) GetErr(key string) ([]byte, error) {
+	key = c.normalize(key)
+	if c.latency != nil {
+		defer c.recordLatency(&c.latency.get, key, time.Now())
+	}
+	if e, found := c.lookup(key); found {
+		return c.valueOut(e), nil
+	}
+	if c.loader == nil {
+		return nil, ErrNotFound
+	}
+	value, err := c.load(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.copyOut(value), nil
+}
+
+// lookup looks key up like Get, refreshing the item ahead of its expiry
+// if Config.RefreshThreshold asks for it, but without falling back to the
+// Loader.
+func (c *Cache) lookup(key string) (*entry, bool) {
+	if c.refreshThreshold > 0 {
+		return c.getRefresh(key)
+	}
+	return c.get(key)
+}
+
+// get implements Get without falling back to the Loader. The value and
+// compressed fields of the returned entry never change, so they may be
+// read after the shard lock is released; with Config.PooledValues, this
+// makes get return a pinned copy of the entry.
+func (c *Cache) get(key string) (*entry, bool) {
+	c.recordLookup(key)
+	if c.bloomMiss(key) {
+		return nil, false
+	}
+	shard, write := c.lockLookupShard(key)
+	e, found := c.lookupLocked(shard, key, write)
+	if found {
+		e = e.pinned()
+	}
+	stale := !found && c.expiredLocked(shard, key, write)
+	c.unlockLookup(shard, write)
+	if stale {
+		c.deleteIfExpired(key)
+	}
+	return e, found
+}
+
+// expiredLocked is called after a lookup of key in shard missed, to
+// remove the expired item the key may still hold. If the caller holds the
+// write lock, it removes the item. Otherwise it reports whether there is
+// one, for the caller to remove with deleteIfExpired once it has released
+// the read lock.
+func (c *Cache) expiredLocked(shard *cacheShard, key string, write bool) bool {
+	e, found := shard.items[key]
+	if !found {
+		return false
+	}
+	if write {
+		c.evictLocked(shard, e, ReasonExpired)
+		return false
+	}
+	return true
+}
+
+// lockLookup locks shard for lookupLocked, and reports whether it took
+// the write lock. Lookups only need the read lock unless they update the
+// LRU list or extend expiry times, which mutate the shard. With
+// Config.RecencySampleRate, only a sample of the lookups that update the
+// LRU list take the write lock.
+func (c *Cache) lockLookup(shard *cacheShard) bool {
+	if c.lookupWrites && (c.recencySampleRate == 0 || c.sliding || rand.Float64() < c.recencySampleRate) {
+		shard.mu.Lock()
+		return true
+	}
 	shard.mu.RLock()
+	return false
+}
+
+// unlockLookup releases a lock taken by lockLookup, which returned write.
+func (c *Cache) unlockLookup(shard *cacheShard, write bool) {
+	if write {
+		c.unlock(shard)
+	} else {
+		shard.mu.RUnlock()
+	}
+}
+
+// lookupLocked returns the live entry for key in shard, recording the
+// lookup in the shard's statistics. If write is set, meaning the caller
+// holds the write lock, a hit is also marked as recently used and, in
+// sliding expiration mode, has its expiry extended. The caller must hold
+// the lock taken by lockLookup, or the write lock.
+func (c *Cache) lookupLocked(shard *cacheShard, key string, write bool) (*entry, bool) {
+	if c.sketch != nil {
+		c.sketch.increment(bloomHash(key))
+	}
+	e, found := c.liveLocked(shard, key)
+	if !found || c.verifyChecksums && !c.intact(e) {
+		shard.stats.misses.Add(1)
+		return nil, false
+	}
+	if c.bounded && (write || c.sampled > 0) {
+		c.accessLocked(shard, e)
+	}
+	if write && c.sliding && e.ttl > 0 {
+		e.expiresAt = c.now() + int64(e.ttl)
+		c.reindexLocked(e)
+		c.scheduleLocked(shard, e)
+	}
+	if e.maxIdle > 0 {
+		e.usedAt.Store(c.now())
+		if e.member != nil {
+			e.member.expiresAt.Store(e.deadline())
+		}
+	}
+	if c.trackAccess {
+		e.accessedAt.Store(c.now())
+		e.hits.Add(1)
+	}
+	shard.stats.hits.Add(1)
+	return e, true
+}
+
+// liveLocked returns the entry for key in shard if it exists and has not
+// expired, without recording statistics or marking it as recently used.
+// The caller must hold at least the shard's read lock.
+func (c *Cache) liveLocked(shard *cacheShard, key string) (*entry, bool) {
+	e, found := shard.items[key]
+	if !found || (e.expiresAt != 0 || e.maxIdle != 0) && e.expired(c.now()) {
+		return nil, false
+	}
+	return e, true
+}
+
+// Peek retrieves an item from the cache like Get, but without any of
+// Get's side effects: it does not mark the item as recently used or
+// count it for the eviction policy, does not extend its expiry in
+// sliding expiration mode, does not record a hit or a miss in the
+// statistics, and never invokes the Loader. It suits inspecting the
+// cache, for example from an admin endpoint, without distorting eviction
+// decisions.
+func (c *Cache) Peek(key string) ([]byte, bool) {
+	key = c.normalize(key)
+	shard := c.rlockShard(key)
+	e, found := c.liveLocked(shard, key)
+	if found {
+		e = e.pinned()
+	}
+	shard.mu.RUnlock()
+	if !found {
+		return nil, false
+	}
+	return c.valueOut(e), true
+}
+
+// peek returns the live value for key without recording statistics or
+// marking it as recently used.
+func (c *Cache) peek(key string) ([]byte, bool) {
+	shard := c.rlockShard(key)
 	defer shard.mu.RUnlock()
-	val, found := shard.items[key]
-	return val, found
+	e, found := c.liveLocked(shard, key)
+	if !found {
+		return nil, false
+	}
+	return c.valueOf(e.pinned()), true
 }
 
 // Delete removes an item from the cache.
 func (c *Cache) Delete(key string) {
-	shard := c.getShard(key)
-	shard.mu.Lock()
-	defer shard.mu.Unlock()
-	delete(shard.items, key)
+	c.delete(c.normalize(key))
+}
+
+// delete implements Delete for a normalized key.
+func (c *Cache) delete(key string) {
+	if c.writeErr() != nil {
+		return
+	}
+	shard := c.lockShard(key)
+	defer c.unlock(shard)
+	if e, found := shard.items[key]; found {
+		c.deleteLocked(shard, e)
+	}
 }
 
 // Len returns the total number of items in the cache.
+// Expired items that have not been removed yet are included in the count.
+// Len reads a counter per shard without taking any locks, so it is cheap
+// to call often, but it is not a point-in-time view while writes are in
+// progress.
 func (c *Cache) Len() int {
-	total := 0
-	for _, shard := range c.shards {
-		shard.mu.RLock()
-		total += len(shard.items)
-		shard.mu.RUnlock()
+	var total int64
+	for _, shard := range c.table().shards {
+		total += shard.length.Load()
 	}
-	return total
+	return int(total)
+}
+
+// SizeBytes returns the total length in bytes of all keys and values in
+// the cache. It is maintained incrementally as items are written and
+// removed, so it is cheap to call. It does not include the memory used by
+// the maps, entry metadata or other internal structures, so the real
+// memory footprint of the cache is larger. Expired items that have not
+// been removed yet are included.
+func (c *Cache) SizeBytes() int64 {
+	return c.size.Load()
 }
 
-// Has checks if a key exists in the cache.
+// Has checks if a key exists in the cache. Expired items are reported as
+// missing and are removed on the spot, triggering OnEvict with
+// ReasonExpired. Has counts as a lookup in the cache's hit and miss
+// statistics, but never invokes the Loader. With Config.MembershipIndex,
+// Has does not lock the item's shard unless the item has expired, and
+// does not mark it as recently used.
 func (c *Cache) Has(key string) bool {
-	_, found := c.Get(key)
+	key = c.normalize(key)
+	if c.index != nil {
+		return c.hasIndexed(key)
+	}
+	_, found := c.get(key)
 	return found
 }
 
+// deleteIfExpired removes the item stored under key if it has expired, so
+// that it does not linger until the next sweep. The write lock is only
+// taken if an expired item was found under the read lock.
+func (c *Cache) deleteIfExpired(key string) {
+	shard := c.rlockShard(key)
+	e, found := shard.items[key]
+	expired := found && e.expired(c.now())
+	shard.mu.RUnlock()
+	if !expired {
+		return
+	}
+	shard.mu.Lock()
+	defer c.unlock(shard)
+	if e, found := shard.items[key]; found && e.expired(c.now()) {
+		c.evictLocked(shard, e, ReasonExpired)
+	}
+}
+
+// Close stops all background goroutines started by the cache, waits for
+// them to exit, releases the cached items, and closes the channels of
+// all subscribers.
+//
+// After Close returns, Set, SetWithTTL and Delete are no-ops, and Get and
+// Has report every key as missing. Operations running concurrently with
+// Close may still complete. Calling Close more than once returns
+// ErrClosed.
+func (c *Cache) Close() error {
+	if !c.closed.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+	close(c.done)
+	// Let tasks being started finish starting, so that wg counts them.
+	c.starting.Lock()
+	c.starting.Unlock()
+	c.wg.Wait()
+	c.clear()
+	c.closeSubscriptions()
+	return nil
+}
+
+// Clear removes every item from the cache. Each shard's map is replaced
+// with a fresh one so that the memory held by the old map can be
+// reclaimed by the garbage collector. Shards are cleared one at a time,
+// so Clear is safe to call concurrently with other operations, which may
+// observe some shards already cleared and others not yet. Statistics are
+// not reset; use ResetStats for that. Clear is a no-op on a closed cache.
+func (c *Cache) Clear() {
+	if c.writeErr() != nil {
+		return
+	}
+	c.clear()
+	c.markDirty()
+}
+
+// clear empties every shard.
+func (c *Cache) clear() {
+	c.maxValue.Store(0)
+	if c.churn != nil {
+		c.churn.reset()
+	}
+	shards := c.table().shards
+	for _, shard := range shards {
+		shard.mu.Lock()
+		if c.bounded {
+			c.count.Add(-int64(len(shard.items)))
+			for _, e := range shard.items {
+				c.cost.Add(-e.weight())
+			}
+		}
+		if c.index != nil || c.tags.used.Load() {
+			for _, e := range shard.items {
+				c.unindexLocked(e)
+				c.untagLocked(e)
+			}
+		}
+		if c.pooled {
+			for _, e := range shard.items {
+				if e.pool != nil {
+					e.pool.release()
+				}
+			}
+		}
+		c.size.Add(-shard.size)
+		c.valueSize.Add(-shard.valueSize)
+		shard.reset()
+		shard.bloom.Store(c.newBloomFilterForShard(len(shards)))
+		c.unlock(shard)
+	}
+}
+
+// startTask runs fn in a goroutine tracked by the cache, so that Close
+// waits for it, and reports whether it did, which it does not once the
+// cache is closed.
+func (c *Cache) startTask(fn func()) bool {
+	c.starting.Lock()
+	defer c.starting.Unlock()
+	if c.closed.Load() {
+		return false
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		fn()
+	}()
+	return true
+}
+
+// startWorker runs fn in a background goroutine tracked by the cache.
+// fn must return promptly once stop is closed.
+func (c *Cache) startWorker(fn func(stop <-chan struct{})) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		fn(c.done)
+	}()
+}
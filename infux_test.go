@@ -0,0 +1,221 @@
+package infux
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// leakedGoroutines returns the stacks of the goroutines running code of
+// the package, other than the tests themselves.
+func leakedGoroutines() []string {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	var leaked []string
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(g, "github.com/VectroLabs/infux.") && !strings.Contains(g, "testing.tRunner") {
+			leaked = append(leaked, g)
+		}
+	}
+	return leaked
+}
+
+// checkNoLeaks fails the test if goroutines of the package are still
+// running once those exiting have had a moment to do so.
+func checkNoLeaks(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		leaked := leakedGoroutines()
+		if len(leaked) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines leaked, first:\n%s", len(leaked), leaked[0])
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCloseStopsBackgroundGoroutines(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 50; i++ {
+		c := NewWithConfig(Config{
+			CleanupInterval: time.Millisecond,
+			Persist:         PersistConfig{Path: filepath.Join(dir, "snapshot"), Interval: time.Millisecond},
+		})
+		c.SetWithTTL("k", []byte("v"), time.Millisecond)
+		ch := c.Subscribe("k")
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// Close closes the channels of subscribers.
+		for range ch {
+		}
+	}
+	checkNoLeaks(t)
+}
+
+func TestClosedCache(t *testing.T) {
+	c := New()
+	c.Set("k", []byte("v"))
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("second Close = %v, want ErrClosed", err)
+	}
+	c.Set("k", []byte("v"))
+	if _, found := c.Get("k"); found {
+		t.Fatal("Get found an item in a closed cache")
+	}
+	if err := c.TrySet("k", []byte("v")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("TrySet = %v, want ErrClosed", err)
+	}
+}
+
+func TestHashKeyMatchesFNV1a(t *testing.T) {
+	for _, key := range []string{"", "a", "user:42", strings.Repeat("x", 1000)} {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		// hashKey folds the high half of FNV-1a into the low bits.
+		if got, want := hashKey(key), h.Sum64()^h.Sum64()>>32; got != want {
+			t.Errorf("hashKey(%q) = %x, want %x", key, got, want)
+		}
+	}
+}
+
+// shardSpread hashes n keys of the given form into 256 shards by the low
+// byte of hash, and returns the chi-squared statistic of the shard
+// counts, which is about 255 for a uniform hash.
+func shardSpread(n int, format string, hash func(string) uint64) float64 {
+	var counts [256]int
+	for i := 0; i < n; i++ {
+		counts[hash(fmt.Sprintf(format, i))&255]++
+	}
+	mean := float64(n) / 256
+	var chi2 float64
+	for _, count := range counts {
+		d := float64(count) - mean
+		chi2 += d * d / mean
+	}
+	return chi2
+}
+
+func TestHashKeySpreadsKeysEvenly(t *testing.T) {
+	fnv32 := func(key string) uint64 {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		return uint64(h.Sum32())
+	}
+	for _, format := range []string{"%d", "user:%d", "session-%08x"} {
+		got, old := shardSpread(100000, format, hashKey), shardSpread(100000, format, fnv32)
+		// 400 is far in the tail of chi-squared with 255 degrees of
+		// freedom, which a uniform hash exceeds with probability 1e-8.
+		if got > 400 || got > old*1.25 {
+			t.Errorf("keys %q: chi-squared %.0f over 256 shards, 32-bit FNV-1a %.0f", format, got, old)
+		}
+	}
+}
+
+func TestGetShardDoesNotAllocate(t *testing.T) {
+	c := New()
+	key := "user:42"
+	if n := testing.AllocsPerRun(100, func() { c.getShard(key) }); n != 0 {
+		t.Fatalf("getShard allocates %v times per call, want 0", n)
+	}
+}
+
+func BenchmarkGetShard(b *testing.B) {
+	c := New()
+	key := strings.Repeat("session:", 8)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.getShard(key)
+	}
+}
+
+func TestLenCountsOverwritesOnce(t *testing.T) {
+	c := New()
+	c.Set("a", []byte("1"))
+	c.Set("a", []byte("2"))
+	c.Set("b", []byte("3"))
+	c.Delete("missing")
+	if n := c.Len(); n != 2 {
+		t.Fatalf("Len = %d, want 2", n)
+	}
+	c.Delete("a")
+	c.Delete("a")
+	if n := c.Len(); n != 1 {
+		t.Fatalf("Len = %d after deleting a, want 1", n)
+	}
+}
+
+// lockedLen counts items the way Len did before it read a counter per
+// shard, read-locking every shard in turn.
+func lockedLen(c *Cache) int {
+	total := 0
+	for _, shard := range c.table().shards {
+		shard.mu.RLock()
+		total += len(shard.items)
+		shard.mu.RUnlock()
+	}
+	return total
+}
+
+// BenchmarkLen measures Len while other goroutines keep writing.
+func BenchmarkLen(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		len  func(*Cache) int
+	}{{"counters", (*Cache).Len}, {"locked", lockedLen}} {
+		b.Run(bench.name, func(b *testing.B) {
+			c := New()
+			stop := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+						c.Set(fmt.Sprint(i%10000), []byte("v"))
+					}
+				}
+			}()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				bench.len(c)
+			}
+			b.StopTimer()
+			close(stop)
+			<-done
+		})
+	}
+}
+
+func TestHasRemovesExpiredEntry(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		c, clk := newTestCache(Config{MembershipIndex: indexed})
+		c.SetWithTTL("k", []byte("v"), time.Second)
+		if !c.Has("k") {
+			t.Fatalf("indexed=%v: Has = false before expiry", indexed)
+		}
+		clk.Advance(time.Second)
+		if c.Len() != 1 {
+			t.Fatalf("indexed=%v: Len = %d before Has, want 1", indexed, c.Len())
+		}
+		if c.Has("k") {
+			t.Fatalf("indexed=%v: Has = true for an expired key", indexed)
+		}
+		if c.Len() != 0 {
+			t.Fatalf("indexed=%v: Len = %d after Has, want the expired entry removed", indexed, c.Len())
+		}
+	}
+}
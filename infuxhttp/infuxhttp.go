@@ -0,0 +1,85 @@
+// Package infuxhttp provides an http.Handler for administering an infux
+// cache over HTTP. It lives in its own package so that the core infux
+// package does not depend on net/http.
+package infuxhttp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/VectroLabs/infux"
+)
+
+// StatsPath is the path under which the handler serves the cache's
+// statistics instead of a key.
+const StatsPath = "/_stats"
+
+// Handler serves a cache over HTTP. The URL path, without its leading
+// slash, is the key:
+//
+//	GET    /key   returns the value, or 404 Not Found if the key is missing
+//	PUT    /key   stores the request body as the value, without expiry
+//	DELETE /key   removes the key
+//	GET    /_stats returns the cache's Stats as JSON
+//
+// Use http.StripPrefix to mount it under a path other than the root.
+// The handler performs no authentication, so it should only be exposed
+// to trusted clients.
+type Handler struct {
+	cache *infux.Cache
+}
+
+// NewHandler returns a Handler serving cache.
+func NewHandler(cache *infux.Cache) *Handler {
+	return &Handler{cache: cache}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == StatsPath {
+		h.serveStats(w, r)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if key == "" {
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		value, found := h.cache.Get(key)
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(value)
+	case http.MethodPut:
+		value, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.cache.Set(key, value)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		h.cache.Delete(key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveStats writes the cache's statistics as JSON.
+func (h *Handler) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.cache.Stats())
+}
@@ -0,0 +1,106 @@
+package infuxhttp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VectroLabs/infux"
+)
+
+func do(t *testing.T, srv *httptest.Server, method, path, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+func TestHandlerCRUD(t *testing.T) {
+	cache := infux.New()
+	defer cache.Close()
+	srv := httptest.NewServer(NewHandler(cache))
+	defer srv.Close()
+
+	if resp, _ := do(t, srv, http.MethodGet, "/k", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET missing key: status %d, want 404", resp.StatusCode)
+	}
+	if resp, _ := do(t, srv, http.MethodPut, "/k", "v"); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT: status %d, want 204", resp.StatusCode)
+	}
+	if v, _ := cache.Get("k"); string(v) != "v" {
+		t.Fatalf("cache holds %q after PUT, want %q", v, "v")
+	}
+	resp, body := do(t, srv, http.MethodGet, "/k", "")
+	if resp.StatusCode != http.StatusOK || body != "v" {
+		t.Fatalf("GET: status %d body %q, want 200 %q", resp.StatusCode, body, "v")
+	}
+	if resp, _ := do(t, srv, http.MethodDelete, "/k", ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d, want 204", resp.StatusCode)
+	}
+	if cache.Has("k") {
+		t.Fatal("key present after DELETE")
+	}
+	if resp, _ := do(t, srv, http.MethodGet, "/k", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET deleted key: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestHandlerRejects(t *testing.T) {
+	cache := infux.New()
+	defer cache.Close()
+	srv := httptest.NewServer(NewHandler(cache))
+	defer srv.Close()
+
+	if resp, _ := do(t, srv, http.MethodGet, "/", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("GET /: status %d, want 400", resp.StatusCode)
+	}
+	resp, _ := do(t, srv, http.MethodPost, "/k", "v")
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("POST: status %d, want 405", resp.StatusCode)
+	}
+	if allow := resp.Header.Get("Allow"); allow == "" {
+		t.Fatal("405 response has no Allow header")
+	}
+	if resp, _ := do(t, srv, http.MethodPut, StatsPath, "v"); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("PUT %s: status %d, want 405", StatsPath, resp.StatusCode)
+	}
+}
+
+func TestHandlerStats(t *testing.T) {
+	cache := infux.New()
+	defer cache.Close()
+	cache.Set("k", []byte("v"))
+	cache.Get("k")
+	cache.Get("missing")
+	srv := httptest.NewServer(NewHandler(cache))
+	defer srv.Close()
+
+	resp, body := do(t, srv, http.MethodGet, StatsPath, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d, want 200", StatsPath, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var stats infux.Stats
+	if err := json.Unmarshal([]byte(body), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Sets != 1 {
+		t.Fatalf("stats = %+v, want 1 hit, 1 miss and 1 set", stats)
+	}
+}
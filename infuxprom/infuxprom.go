@@ -0,0 +1,102 @@
+// Package infuxprom exports infux cache metrics to Prometheus.
+// It lives in its own module so that the core infux package does not
+// depend on the Prometheus client library.
+package infuxprom
+
+import (
+	"github.com/VectroLabs/infux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector that reports the statistics of a
+// single infux cache. Metrics are read from the cache only when Prometheus
+// scrapes them, so collecting adds no overhead to cache operations.
+type Collector struct {
+	cache *infux.Cache
+
+	hits        *prometheus.Desc
+	misses      *prometheus.Desc
+	sets        *prometheus.Desc
+	deletes     *prometheus.Desc
+	evictions   *prometheus.Desc
+	expirations *prometheus.Desc
+	items       *prometheus.Desc
+	size        *prometheus.Desc
+	avgValue    *prometheus.Desc
+	maxValue    *prometheus.Desc
+	getLatency  *prometheus.Desc
+	setLatency  *prometheus.Desc
+}
+
+// NewCollector returns a Collector for cache. Metric names are prefixed
+// with namespace, and constLabels are attached to every metric, which
+// allows several caches to be registered side by side, for example with a
+// "cache" label naming each one.
+func NewCollector(cache *infux.Cache, namespace string, constLabels prometheus.Labels) *Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", name), help, nil, constLabels)
+	}
+	return &Collector{
+		cache:       cache,
+		hits:        desc("hits_total", "Number of lookups that found a live item."),
+		misses:      desc("misses_total", "Number of lookups that found no live item."),
+		sets:        desc("sets_total", "Number of items written."),
+		deletes:     desc("deletes_total", "Number of items removed by Delete."),
+		evictions:   desc("evictions_total", "Number of items evicted to respect the cache limits."),
+		expirations: desc("expirations_total", "Number of expired items removed from the cache."),
+		items:       desc("items", "Number of items currently in the cache."),
+		size:        desc("size_bytes", "Total length of all keys and values in the cache."),
+		avgValue:    desc("avg_value_bytes", "Average length of the values in the cache."),
+		maxValue:    desc("max_value_bytes", "Length of the largest value stored since the cache was created or cleared."),
+		getLatency:  desc("get_latency_seconds", "Duration of Get calls, with infux.Config.TrackLatency."),
+		setLatency:  desc("set_latency_seconds", "Duration of Set calls, with infux.Config.TrackLatency."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.sets
+	ch <- c.deletes
+	ch <- c.evictions
+	ch <- c.expirations
+	ch <- c.items
+	ch <- c.size
+	ch <- c.avgValue
+	ch <- c.maxValue
+	ch <- c.getLatency
+	ch <- c.setLatency
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.sets, prometheus.CounterValue, float64(stats.Sets))
+	ch <- prometheus.MustNewConstMetric(c.deletes, prometheus.CounterValue, float64(stats.Deletes))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.expirations, prometheus.CounterValue, float64(stats.Expirations))
+	ch <- prometheus.MustNewConstMetric(c.items, prometheus.GaugeValue, float64(c.cache.Len()))
+	ch <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, float64(c.cache.SizeBytes()))
+	ch <- prometheus.MustNewConstMetric(c.avgValue, prometheus.GaugeValue, stats.AvgValueBytes)
+	ch <- prometheus.MustNewConstMetric(c.maxValue, prometheus.GaugeValue, float64(stats.MaxValueBytes))
+	// Latencies are only recorded with Config.TrackLatency.
+	latency := c.cache.LatencyStats()
+	if latency.Get.Count > 0 {
+		ch <- latencySummary(c.getLatency, latency.Get)
+	}
+	if latency.Set.Count > 0 {
+		ch <- latencySummary(c.setLatency, latency.Set)
+	}
+}
+
+// latencySummary returns a summary metric of q in seconds.
+func latencySummary(desc *prometheus.Desc, q infux.LatencyQuantiles) prometheus.Metric {
+	return prometheus.MustNewConstSummary(desc, q.Count, q.Total.Seconds(), map[float64]float64{
+		0.5:  q.P50.Seconds(),
+		0.9:  q.P90.Seconds(),
+		0.99: q.P99.Seconds(),
+	})
+}
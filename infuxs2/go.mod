@@ -0,0 +1,10 @@
+module github.com/VectroLabs/infux/infuxs2
+
+go 1.25
+
+require (
+	github.com/VectroLabs/infux v0.0.0
+	github.com/klauspost/compress v1.20.1
+)
+
+replace github.com/VectroLabs/infux => ../
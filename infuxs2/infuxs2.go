@@ -0,0 +1,26 @@
+// Package infuxs2 provides an infux.Compressor that uses S2, an extension
+// of Snappy that trades a little compression for much faster encoding and
+// decoding than gzip. It lives in its own module so that the core infux
+// package does not depend on the compression library.
+package infuxs2
+
+import (
+	"github.com/VectroLabs/infux"
+	"github.com/klauspost/compress/s2"
+)
+
+// Compressor is an infux.Compressor that uses S2 block encoding. The zero
+// value is ready to use and safe for concurrent use.
+type Compressor struct{}
+
+var _ infux.Compressor = Compressor{}
+
+// Compress implements infux.Compressor.
+func (Compressor) Compress(src []byte) ([]byte, error) {
+	return s2.Encode(nil, src), nil
+}
+
+// Decompress implements infux.Compressor.
+func (Compressor) Decompress(src []byte) ([]byte, error) {
+	return s2.Decode(nil, src)
+}
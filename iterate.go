@@ -0,0 +1,156 @@
+package infux
+
+import "math/rand"
+
+// Keys returns the keys of all live items in the cache, in no particular
+// order. Each shard is read under its own lock, so the result is a
+// best-effort snapshot: writes made concurrently with Keys may or may not
+// be reflected.
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	c.ForEach(func(key string, _ []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// RandomKeys returns up to n keys of live items picked at random, for
+// sampling-based algorithms such as admission or eviction policies built
+// on top of the cache. It starts at a random shard and takes the keys
+// from a random point of its map, moving on to the next shards only while
+// it needs more keys, so it usually reads a single shard, under its read
+// lock, in time proportional to n rather than to the size of the cache.
+// The sample is approximate: keys taken from one shard come in map order
+// from their starting point rather than independently, and since each
+// shard is as likely to be picked whatever its size, keys of shards
+// holding fewer items are somewhat more likely to be returned. Barring a
+// concurrent Resize, it returns fewer than n keys only if the cache holds
+// fewer than n live items, after visiting every shard.
+func (c *Cache) RandomKeys(n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	shards := c.table().shards
+	keys := make([]string, 0, n)
+	start := rand.Intn(len(shards))
+	for i := 0; i < len(shards) && len(keys) < n; i++ {
+		shard := shards[(start+i)%len(shards)]
+		shard.mu.RLock()
+		now := c.now()
+		for key, e := range shard.items {
+			if len(keys) == n {
+				break
+			}
+			if !e.expired(now) {
+				keys = append(keys, key)
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return keys
+}
+
+// ForEach calls fn for each live item in the cache, in no particular
+// order, until fn returns false. Items are visited one shard at a time
+// while holding that shard's read lock, so iteration sees a best-effort
+// snapshot and may miss writes made concurrently. fn must not modify the
+// cache, as writing to the shard being iterated deadlocks. fn must not
+// retain or modify value.
+func (c *Cache) ForEach(fn func(key string, value []byte) bool) {
+	for _, shard := range c.table().shards {
+		if !c.forEachInShard(shard, fn) {
+			return
+		}
+	}
+}
+
+// forEachInShard calls fn for each live item in shard under its read
+// lock, and reports whether iteration should continue.
+func (c *Cache) forEachInShard(shard *cacheShard, fn func(key string, value []byte) bool) bool {
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	now := c.now()
+	for key, e := range shard.items {
+		if e.expired(now) {
+			continue
+		}
+		if !fn(key, c.valueLent(e)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ForEachSnapshot calls fn for each live item in the cache, in no
+// particular order. Unlike ForEach, it holds each shard's read lock only
+// long enough to collect the shard's live entries, and calls fn after
+// releasing it, so a slow fn does not block writers. The price is a
+// transient allocation the size of one shard's entry list. Each shard is
+// a consistent snapshot, but shards are taken one after another, so the
+// cache as a whole is not. Because no lock is held while it runs, fn may
+// use the cache. Values follow Config.CopyOnGet like Get's.
+func (c *Cache) ForEachSnapshot(fn func(key string, value []byte)) {
+	var live []*entry
+	for _, shard := range c.table().shards {
+		live = c.liveEntries(shard, live[:0])
+		for _, e := range live {
+			fn(e.key, c.valueOut(e))
+		}
+	}
+}
+
+// liveEntries appends the live entries of shard to live under the
+// shard's read lock. The value and compressed fields of the entries never
+// change, so they may be read after the lock is released.
+func (c *Cache) liveEntries(shard *cacheShard, live []*entry) []*entry {
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	now := c.now()
+	for _, e := range shard.items {
+		if !e.expired(now) {
+			live = append(live, e.pinned())
+		}
+	}
+	return live
+}
+
+// UpdateEach calls fn for each live item in the cache, in no particular
+// order, to rewrite values in one maintenance pass, for example to
+// re-encrypt them under a new key. If fn returns keep false, the item is
+// deleted, like Delete. Otherwise, a non-nil newValue replaces the value,
+// keeping the item's expiry, and a nil newValue leaves the item as it is.
+// Items are visited one shard at a time while holding that shard's write
+// lock, which blocks all readers and writers of the shard until fn has
+// seen all of its items, so fn should be fast and must not use the cache.
+// fn must not retain or modify value. UpdateEach is a no-op on a closed
+// cache.
+func (c *Cache) UpdateEach(fn func(key string, value []byte) (newValue []byte, keep bool)) {
+	if c.writeErr() != nil {
+		return
+	}
+	for _, shard := range c.table().shards {
+		c.updateInShard(shard, fn)
+		c.evictOverflow(shard)
+	}
+}
+
+// updateInShard implements UpdateEach for the items of shard. The shard
+// is unlocked even if fn panics.
+func (c *Cache) updateInShard(shard *cacheShard, fn func(key string, value []byte) ([]byte, bool)) {
+	shard.mu.Lock()
+	defer c.unlock(shard)
+	now := c.now()
+	for key, e := range shard.items {
+		if e.expired(now) {
+			continue
+		}
+		value, keep := fn(key, c.valueLent(e))
+		switch {
+		case !keep:
+			c.deleteLocked(shard, e)
+		case value != nil:
+			c.insertLocked(shard, c.newEntry(key, value).keepExpiry(e))
+		}
+	}
+}
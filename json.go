@@ -0,0 +1,40 @@
+package infux
+
+import "encoding/json"
+
+// MarshalJSON implements json.Marshaler. It encodes the live items of the
+// cache as a JSON object mapping each key to its value, base64-encoded
+// like any []byte. Expiry times are not included. Shards are read one at
+// a time, as by ForEach, so the result is a best-effort snapshot. It is
+// a convenience for debugging and exports, and is expensive for large
+// caches; use Snapshot for backups.
+func (c *Cache) MarshalJSON() ([]byte, error) {
+	items := make(map[string][]byte, c.Len())
+	c.ForEach(func(key string, value []byte) bool {
+		items[key] = value
+		return true
+	})
+	return json.Marshal(items)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It decodes an object as
+// written by MarshalJSON and replaces the contents of the cache with its
+// items, which never expire. A zero Cache is initialized with the default
+// configuration first, so a cache can be decoded into a new variable. If
+// data is invalid, the cache is left unchanged. On a closed cache it
+// returns ErrClosed.
+func (c *Cache) UnmarshalJSON(data []byte) error {
+	var items map[string][]byte
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	if c.table() == nil {
+		c.init(defaultShardCount)
+	} else if err := c.writeErr(); err != nil {
+		return err
+	} else {
+		c.clear()
+	}
+	c.SetMulti(items)
+	return nil
+}
@@ -0,0 +1,142 @@
+package infux
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// latencyStripes is the number of independent histograms each operation
+// is recorded in with Config.TrackLatency. An operation on a key is
+// always recorded in the histogram chosen by the key's hash.
+const latencyStripes = 16
+
+// Latency histograms have latencySubBuckets buckets per power of two of
+// nanoseconds, which bounds the error of a reported quantile to 1/8 of
+// its value, for durations below 2^(latencyMaxExp+1) nanoseconds, about
+// two and a half hours. Longer operations are recorded in the last
+// bucket.
+const (
+	latencySubBits    = 3
+	latencySubBuckets = 1 << latencySubBits
+	latencyMaxExp     = 42
+	latencyBuckets    = (latencyMaxExp - latencySubBits + 2) * latencySubBuckets
+)
+
+// LatencyQuantiles summarizes the recorded durations of one operation.
+type LatencyQuantiles struct {
+	// Count is the number of operations recorded and Total their total
+	// duration.
+	Count uint64
+	Total time.Duration
+	// P50, P90 and P99 are the durations that 50, 90 and 99 percent of
+	// the operations took at most, or 0 if none were recorded. They are
+	// read from a bucketed histogram, and may overestimate the true
+	// quantile by up to an eighth.
+	P50, P90, P99 time.Duration
+}
+
+// LatencyStats holds the latencies of cache operations, as returned by
+// LatencyStats.
+type LatencyStats struct {
+	// Get covers Get, including any load through the Loader on a miss.
+	Get LatencyQuantiles
+	// Set covers Set, SetWithTTL, SetWithDeadline and TrySet.
+	Set LatencyQuantiles
+}
+
+// latencyRecorder records the durations of Get and Set calls, for
+// Config.TrackLatency.
+type latencyRecorder struct {
+	get, set [latencyStripes]latencyHistogram
+}
+
+// latencyHistogram counts durations in log-linear buckets. It is updated
+// with atomic operations only, so recording never blocks.
+type latencyHistogram struct {
+	buckets [latencyBuckets]atomic.Uint64
+	total   atomic.Int64
+}
+
+// latencyBucket returns the index of the bucket counting d nanoseconds:
+// durations below latencySubBuckets each have their own bucket, and
+// every longer power of two range is split into latencySubBuckets equal
+// buckets.
+func latencyBucket(d int64) int {
+	if d < latencySubBuckets {
+		return int(max(d, 0))
+	}
+	exp := bits.Len64(uint64(d)) - 1
+	if exp > latencyMaxExp {
+		return latencyBuckets - 1
+	}
+	sub := int(d>>(exp-latencySubBits)) & (latencySubBuckets - 1)
+	return (exp-latencySubBits+1)*latencySubBuckets + sub
+}
+
+// latencyBucketMax returns the largest duration, in nanoseconds, counted
+// by bucket i.
+func latencyBucketMax(i int) int64 {
+	if i < latencySubBuckets {
+		return int64(i)
+	}
+	exp := i/latencySubBuckets + latencySubBits - 1
+	sub := int64(i % latencySubBuckets)
+	return (latencySubBuckets+sub+1)<<(exp-latencySubBits) - 1
+}
+
+// record counts an operation that ran for d.
+func (h *latencyHistogram) record(d time.Duration) {
+	h.buckets[latencyBucket(int64(d))].Add(1)
+	h.total.Add(int64(d))
+}
+
+// recordLatency records the duration of an operation on key started at
+// start.
+func (c *Cache) recordLatency(stripes *[latencyStripes]latencyHistogram, key string, start time.Time) {
+	stripes[c.hash(key)%latencyStripes].record(time.Since(start))
+}
+
+// quantiles merges the histograms of stripes and summarizes them.
+func quantiles(stripes *[latencyStripes]latencyHistogram) LatencyQuantiles {
+	var q LatencyQuantiles
+	var counts [latencyBuckets]uint64
+	for i := range stripes {
+		for j := range counts {
+			n := stripes[i].buckets[j].Load()
+			counts[j] += n
+			q.Count += n
+		}
+		q.Total += time.Duration(stripes[i].total.Load())
+	}
+	if q.Count == 0 {
+		return q
+	}
+	quantile := func(p float64) time.Duration {
+		rank := uint64(p * float64(q.Count))
+		var seen uint64
+		for i, n := range counts {
+			seen += n
+			if seen > rank {
+				return time.Duration(latencyBucketMax(i))
+			}
+		}
+		return time.Duration(latencyBucketMax(latencyBuckets - 1))
+	}
+	q.P50, q.P90, q.P99 = quantile(0.50), quantile(0.90), quantile(0.99)
+	return q
+}
+
+// LatencyStats returns the latencies of Get and Set calls recorded since
+// the cache was created with Config.TrackLatency, or zero values without
+// it. The histograms are read without locking while operations keep
+// being recorded, so the counts may be off by the operations in flight.
+func (c *Cache) LatencyStats() LatencyStats {
+	if c.latency == nil {
+		return LatencyStats{}
+	}
+	return LatencyStats{
+		Get: quantiles(&c.latency.get),
+		Set: quantiles(&c.latency.set),
+	}
+}
@@ -0,0 +1,66 @@
+package infux
+
+import "errors"
+
+// DefaultMaxEvictionsPerWrite is the number of evictions a write is
+// limited to while the cache catches up with lowered limits, if
+// Config.MaxEvictionsPerWrite is not set.
+const DefaultMaxEvictionsPerWrite = 64
+
+// errUnbounded is returned by SetLimits on a cache created without limits.
+var errUnbounded = errors.New("infux: limits can only be set on a cache created with a limit")
+
+// SetLimits replaces the cache's MaxEntries, MaxBytes and MaxCost limits,
+// for example when a configuration reload shrinks its memory budget. Zero
+// or negative removes a limit. Raising limits takes effect at once.
+// SetLimits does not evict anything itself when it lowers them below the
+// cache's contents: to keep operations fast, each write then evicts at
+// most Config.MaxEvictionsPerWrite items under its shard's lock, and as
+// many from other shards, on top of what it needs to make room for its
+// own item, while the background sweeper, if one runs, evicts the rest
+// in batches of that size. The excess thus never grows, and shrinks with
+// every write until the cache is back within its limits, even without a
+// sweeper. Until then, the cache holds more than the limits allow.
+//
+// The cache must have been created with at least one of the limits, or
+// MaxEntriesPerShard, as a cache without limits does not track what
+// eviction needs; SetLimits returns an error otherwise, and ErrClosed on
+// a closed cache.
+func (c *Cache) SetLimits(maxEntries int, maxBytes, maxCost int64) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	if !c.bounded {
+		return errUnbounded
+	}
+	c.maxEntries.Store(max(int64(maxEntries), 0))
+	c.maxBytes.Store(max(maxBytes, 0))
+	c.maxCost.Store(max(maxCost, 0))
+	if c.overLimit() {
+		c.draining.Store(true)
+	}
+	return nil
+}
+
+// drainOverflow evicts entries, at most maxEvictions at a time per shard
+// lock, until the cache is back within the limits it is draining toward,
+// and then stops draining. It is run by the background sweeper.
+func (c *Cache) drainOverflow() {
+	if !c.draining.Load() {
+		return
+	}
+	for {
+		evicted := false
+		for _, shard := range c.table().shards {
+			shard.mu.Lock()
+			if !shard.moved && c.shrinkLocked(shard, nil, c.maxEvictions) != c.maxEvictions {
+				evicted = true
+			}
+			c.unlock(shard)
+		}
+		if !evicted {
+			break
+		}
+	}
+	c.draining.Store(false)
+}
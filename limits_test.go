@@ -0,0 +1,70 @@
+package infux
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSetLimitsBoundsEvictionsPerWrite(t *testing.T) {
+	const perWrite = 10
+	c := NewWithConfig(Config{Shards: 1, MaxEntries: 1000, MaxEvictionsPerWrite: perWrite})
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprintf("%04d", i), []byte("v"))
+	}
+	if err := c.SetLimits(100, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 1000 {
+		t.Fatalf("SetLimits evicted by itself: Len = %d", c.Len())
+	}
+	before := c.Stats().Evictions
+	c.Set("next", []byte("v"))
+	// Besides its budget, a write evicts as much as its own item adds,
+	// here one item of the same size.
+	if evicted := c.Stats().Evictions - before; evicted == 0 || evicted > perWrite+1 {
+		t.Fatalf("one Set evicted %d items, want 1 to %d", evicted, perWrite+1)
+	}
+	for i := 0; c.Len() > 100; i++ {
+		if i == 1000 {
+			t.Fatalf("Len = %d after %d writes, want the cache back within 100", c.Len(), i)
+		}
+		c.Set(fmt.Sprint("new-", i), []byte("v"))
+	}
+	c.Set("after", []byte("v"))
+	if c.Len() > 100 {
+		t.Fatalf("Len = %d once drained, want at most 100", c.Len())
+	}
+}
+
+func TestSetLimitsDrainsInSweeper(t *testing.T) {
+	c := NewWithConfig(Config{
+		Shards:               4,
+		MaxBytes:             1 << 20,
+		MaxEvictionsPerWrite: 8,
+		CleanupInterval:      time.Millisecond,
+	})
+	defer c.Close()
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint(i), make([]byte, 100))
+	}
+	if err := c.SetLimits(0, 10000, 0); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return c.SizeBytes() <= 10000 })
+	if c.Len() == 0 {
+		t.Fatal("the sweeper evicted everything, want it to stop at the limit")
+	}
+}
+
+func TestSetLimitsErrors(t *testing.T) {
+	if err := New().SetLimits(10, 0, 0); err == nil {
+		t.Fatal("SetLimits succeeded on a cache created without limits")
+	}
+	c := NewWithConfig(Config{MaxEntries: 10})
+	c.Close()
+	if err := c.SetLimits(5, 0, 0); !errors.Is(err, ErrClosed) {
+		t.Fatalf("SetLimits on a closed cache = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,144 @@
+package infux
+
+// lruList is an intrusive, circular doubly-linked list of entries ordered
+// from most to least recently used. The zero value must be initialized
+// with init before use.
+type lruList struct {
+	root entry
+}
+
+// init empties the list.
+func (l *lruList) init() {
+	l.root.next = &l.root
+	l.root.prev = &l.root
+}
+
+// pushFront inserts e at the front of the list.
+func (l *lruList) pushFront(e *entry) {
+	e.prev = &l.root
+	e.next = l.root.next
+	l.root.next.prev = e
+	l.root.next = e
+}
+
+// remove unlinks e from the list.
+func (l *lruList) remove(e *entry) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev = nil
+	e.next = nil
+}
+
+// moveToFront moves e, which must be in the list, to the front.
+func (l *lruList) moveToFront(e *entry) {
+	if l.root.next == e {
+		return
+	}
+	l.remove(e)
+	l.pushFront(e)
+}
+
+// back returns the least recently used entry, or nil if the list is empty.
+func (l *lruList) back() *entry {
+	if l.root.prev == &l.root {
+		return nil
+	}
+	return l.root.prev
+}
+
+// overLimit reports whether the cache holds more entries, bytes or cost
+// than its limits allow.
+func (c *Cache) overLimit() bool {
+	maxEntries, maxBytes, maxCost := c.maxEntries.Load(), c.maxBytes.Load(), c.maxCost.Load()
+	return maxEntries > 0 && c.count.Load() > maxEntries ||
+		maxBytes > 0 && c.size.Load() > maxBytes ||
+		maxCost > 0 && c.cost.Load() > maxCost
+}
+
+// shrinkLocked evicts entries chosen by the eviction policy from shard
+// until the cache and the shard are back within their limits, never
+// evicting keep, or until it has evicted budget entries, unless budget is
+// negative. It returns what is left of the budget. The caller must hold
+// the shard's write lock.
+func (c *Cache) shrinkLocked(shard *cacheShard, keep *entry, budget int) int {
+	for budget != 0 && (c.overLimit() || c.maxShardEntries > 0 && len(shard.items) > c.maxShardEntries) {
+		victim := c.victimLocked(shard, keep)
+		if victim == nil {
+			break
+		}
+		c.evictLocked(shard, victim, ReasonEvicted)
+		if budget > 0 {
+			budget--
+		}
+	}
+	return budget
+}
+
+// payLocked evicts entries chosen by the eviction policy from shard,
+// never keep, until they add up to at least one entry and the size and
+// cost of keep, or the cache is back within its limits. It makes a write
+// to a draining cache evict at least as much as its own item adds,
+// however small the eviction budget, so that the backlog never grows.
+// The caller must hold the shard's write lock.
+func (c *Cache) payLocked(shard *cacheShard, keep *entry) {
+	var entries int
+	var size, cost int64
+	for c.overLimit() && (entries == 0 || size < keep.size() || cost < keep.weight()) {
+		victim := c.victimLocked(shard, keep)
+		if victim == nil {
+			return
+		}
+		entries++
+		size += victim.size()
+		cost += victim.weight()
+		c.evictLocked(shard, victim, ReasonEvicted)
+	}
+}
+
+// evictionBudget returns the number of entries a write may evict from a
+// shard, which is only bounded while the cache drains the backlog left by
+// lowered limits, and -1 otherwise.
+func (c *Cache) evictionBudget() int {
+	if c.draining.Load() {
+		return c.maxEvictions
+	}
+	return -1
+}
+
+// evictOverflow evicts entries from other shards if the cache is still
+// over its limits after a write to shard. The caller must not hold any
+// shard lock.
+func (c *Cache) evictOverflow(shard *cacheShard) {
+	if c.overLimit() {
+		c.evictOthers(shard, nil)
+	}
+	if c.draining.Load() && c.maxShardEntries == 0 && !c.overLimit() {
+		c.draining.Store(false)
+	}
+}
+
+// evictOthers evicts entries from shards other than from until the cache
+// is back within its limits, or until it has evicted as many entries as
+// evictionBudget allows. It is used when the shard that was written to
+// had nothing left to evict. The caller must not hold any shard lock, so
+// that locking another shard cannot deadlock. If captured is not nil, the
+// keys of the evicted entries are appended to it.
+func (c *Cache) evictOthers(from *cacheShard, captured *[]string) {
+	start := c.evictCursor.Add(1)
+	table := c.table()
+	budget := c.evictionBudget()
+	for i := range table.shards {
+		if budget == 0 || !c.overLimit() {
+			return
+		}
+		shard := table.shardFor(uint64(start + uint32(i)))
+		if shard == from {
+			continue
+		}
+		shard.mu.Lock()
+		shard.capture = captured
+		budget = c.shrinkLocked(shard, nil, budget)
+		shard.capture = nil
+		c.unlock(shard)
+	}
+}
@@ -0,0 +1,61 @@
+package infux
+
+// Merge copies the live items of other into c, for example to union
+// caches filled in parallel by independent workers. An item whose key c
+// already holds replaces it if overwrite is set, and is skipped
+// otherwise. Items keep their expiry times, idle times, costs and tags,
+// and their values are copied, decompressed by other's Compressor and
+// compressed again by c's, so that the caches share no memory; they
+// count for c's limits, eviction policy and statistics as if written by
+// Set, and keys are normalized by c's KeyNormalizer.
+//
+// The caches may have different shard counts: every item goes to the
+// shard of c its key hashes to. Each shard of other is read-locked only
+// while its items are copied, and no shard of c is locked meanwhile, so
+// two caches may be merged into each other concurrently without
+// deadlocking. As with Clone, writes to other concurrent with Merge may
+// be reflected for some shards and not for others. Merge is a no-op on a
+// closed cache and if other is c.
+func (c *Cache) Merge(other *Cache, overwrite bool) {
+	if c == other {
+		return
+	}
+	for _, shard := range other.table().shards {
+		if c.writeErr() != nil {
+			return
+		}
+		for _, e := range other.copyLive(shard) {
+			e.key = c.normalize(e.key)
+			c.encode(e)
+			target := c.lockShard(e.key)
+			if _, found := c.liveLocked(target, e.key); found && !overwrite {
+				c.unlock(target)
+				continue
+			}
+			c.insertLocked(target, e)
+			c.unlock(target)
+			c.evictOverflow(target)
+		}
+	}
+}
+
+// copyLive returns new entries holding copies of the keys, decompressed
+// values, costs, expiry settings and tags of the live items of shard.
+func (c *Cache) copyLive(shard *cacheShard) []*entry {
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	now := c.now()
+	entries := make([]*entry, 0, len(shard.items))
+	for _, e := range shard.items {
+		if e.expired(now) {
+			continue
+		}
+		value := c.decode(e.value, e.compressed)
+		if !e.compressed {
+			value = cloneBytes(value)
+		}
+		n := (&entry{key: e.key, value: value, cost: e.cost, tags: e.tags}).keepExpiry(e)
+		entries = append(entries, n)
+	}
+	return entries
+}
@@ -0,0 +1,54 @@
+package infux
+
+import "time"
+
+// EntryMeta describes a stored item without its value, as returned by
+// Meta.
+type EntryMeta struct {
+	// Created is when the item's current value was stored. Every write
+	// to a key stores a new item.
+	Created time.Time
+	// LastAccess is when a lookup last found the item, or the zero time
+	// if none has.
+	LastAccess time.Time
+	// Hits is the number of lookups that found the item since it was
+	// stored.
+	//
+	// LastAccess and Hits are only recorded with Config.TrackAccess, and
+	// are otherwise always zero.
+	Hits uint64
+	// TTL is the item's remaining time-to-live, or NoExpiry if it never
+	// expires.
+	TTL time.Duration
+	// Size is the number of bytes accounted for the item toward
+	// Config.MaxBytes.
+	Size int64
+}
+
+// Meta returns the metadata of the item stored under key, without reading
+// its value, for example to find out why an item is still cached. It
+// reports false if the key is missing or expired. Meta reads the item
+// under the shard's read lock and, unlike Get, does not count as a
+// lookup: it changes no statistics, recency or expiry.
+func (c *Cache) Meta(key string) (EntryMeta, bool) {
+	key = c.normalize(key)
+	shard := c.rlockShard(key)
+	defer shard.mu.RUnlock()
+	e, found := c.liveLocked(shard, key)
+	if !found {
+		return EntryMeta{}, false
+	}
+	meta := EntryMeta{
+		Created: time.Unix(0, e.writtenAt),
+		Hits:    e.hits.Load(),
+		TTL:     NoExpiry,
+		Size:    e.size(),
+	}
+	if at := e.accessedAt.Load(); at != 0 {
+		meta.LastAccess = time.Unix(0, at)
+	}
+	if at := e.deadline(); at != 0 {
+		meta.TTL = max(time.Duration(at-c.now()), 0)
+	}
+	return meta, true
+}
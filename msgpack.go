@@ -0,0 +1,223 @@
+package infux
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Msgpack snapshot format
+//
+// A msgpack snapshot is a stream of MessagePack values, one per item, with
+// no header or trailer. Each item is an array of three elements:
+//
+//	[key, value, expiry]
+//
+// key is a str, value is a bin, and expiry is the absolute expiry time as
+// a float64 of seconds since the Unix epoch, or nil if the item never
+// expires. Using absolute time keeps expiry meaningful however long the
+// snapshot takes to reach its reader. RestoreMsgpack also accepts a bin
+// key, a str value and an integer expiry, which other encoders may
+// produce. In Python, for example, the items can be read with
+//
+//	for key, value, expiry in msgpack.Unpacker(f):
+//	    ...
+
+// SnapshotMsgpack writes all live items in the cache, including their
+// expiry times, to w in the msgpack snapshot format, which tools in other
+// languages can read with any MessagePack library. Like Snapshot, items
+// are copied out of one shard at a time and the snapshot is consistent
+// per shard but not across the whole cache. Snapshot remains the faster
+// and more compact choice for Go programs.
+func (c *Cache) SnapshotMsgpack(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var records []snapshotRecord
+	for _, shard := range c.table().shards {
+		records = c.copyShard(shard, records[:0])
+		for _, rec := range records {
+			bw.WriteByte(0x93) // fixarray of 3 elements
+			writeMsgpackHeader(bw, 0xd9, 0xda, 0xdb, len(rec.key), 0xa0, 32)
+			bw.WriteString(rec.key)
+			writeMsgpackHeader(bw, 0xc4, 0xc5, 0xc6, len(rec.value), 0, 0)
+			bw.Write(rec.value)
+			if rec.expiresAt == 0 {
+				bw.WriteByte(0xc0)
+			} else {
+				var buf [9]byte
+				buf[0] = 0xcb
+				binary.BigEndian.PutUint64(buf[1:], math.Float64bits(float64(rec.expiresAt)/1e9))
+				bw.Write(buf[:])
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// writeMsgpackHeader writes the header of a str or bin of length n, using
+// the 8, 16 or 32-bit length form, or for lengths below fixLimit the fix
+// form with type byte fix|n.
+func writeMsgpackHeader(bw *bufio.Writer, b8, b16, b32 byte, n int, fix byte, fixLimit int) {
+	var buf [5]byte
+	switch {
+	case n < fixLimit:
+		bw.WriteByte(fix | byte(n))
+	case n <= math.MaxUint8:
+		bw.Write([]byte{b8, byte(n)})
+	case n <= math.MaxUint16:
+		buf[0] = b16
+		binary.BigEndian.PutUint16(buf[1:], uint16(n))
+		bw.Write(buf[:3])
+	default:
+		buf[0] = b32
+		binary.BigEndian.PutUint32(buf[1:], uint32(n))
+		bw.Write(buf[:])
+	}
+}
+
+// RestoreMsgpack reads a snapshot in the msgpack snapshot format from r
+// and adds its items to the cache, like Restore: items that have expired
+// are skipped, existing items with the same key are overwritten, and the
+// items read before an error remain in the cache. It returns
+// ErrInvalidSnapshot if the input does not follow the format.
+func (c *Cache) RestoreMsgpack(r io.Reader) error {
+	if err := c.writeErr(); err != nil {
+		return err
+	}
+	br := bufio.NewReader(r)
+	for {
+		kind, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if kind != 0x93 {
+			if n, err := readMsgpackArrayLen(br, kind); err != nil || n != 3 {
+				return fmt.Errorf("%w: item is not an array of 3 elements", ErrInvalidSnapshot)
+			}
+		}
+		key, err := readMsgpackBytes(br)
+		if err != nil {
+			return err
+		}
+		value, err := readMsgpackBytes(br)
+		if err != nil {
+			return err
+		}
+		expiresAt, err := readMsgpackExpiry(br)
+		if err != nil {
+			return err
+		}
+		if expiresAt != 0 && expiresAt <= c.now() {
+			continue
+		}
+		c.set(c.encode(&entry{key: string(key), value: value, expiresAt: expiresAt}))
+	}
+}
+
+// readMsgpackArrayLen reads the length of an array whose type byte kind
+// has already been read.
+func readMsgpackArrayLen(br *bufio.Reader, kind byte) (uint64, error) {
+	switch {
+	case kind&0xf0 == 0x90:
+		return uint64(kind & 0x0f), nil
+	case kind == 0xdc:
+		return readMsgpackUint(br, 2)
+	case kind == 0xdd:
+		return readMsgpackUint(br, 4)
+	}
+	return 0, ErrInvalidSnapshot
+}
+
+// readMsgpackBytes reads a str or bin.
+func readMsgpackBytes(br *bufio.Reader) ([]byte, error) {
+	kind, err := br.ReadByte()
+	if err != nil {
+		return nil, snapshotError(err)
+	}
+	var n uint64
+	switch {
+	case kind&0xe0 == 0xa0:
+		n = uint64(kind & 0x1f)
+	case kind == 0xc4 || kind == 0xd9:
+		n, err = readMsgpackUint(br, 1)
+	case kind == 0xc5 || kind == 0xda:
+		n, err = readMsgpackUint(br, 2)
+	case kind == 0xc6 || kind == 0xdb:
+		n, err = readMsgpackUint(br, 4)
+	default:
+		return nil, fmt.Errorf("%w: expected str or bin, got type 0x%02x", ErrInvalidSnapshot, kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readSnapshotN(br, n)
+}
+
+// readMsgpackExpiry reads an expiry, either nil or a number of seconds
+// since the Unix epoch, and returns it in Unix nanoseconds, or 0 for nil.
+func readMsgpackExpiry(br *bufio.Reader) (int64, error) {
+	kind, err := br.ReadByte()
+	if err != nil {
+		return 0, snapshotError(err)
+	}
+	var seconds float64
+	switch {
+	case kind == 0xc0:
+		return 0, nil
+	case kind < 0x80:
+		seconds = float64(kind)
+	case kind >= 0xcc && kind <= 0xcf:
+		n, err := readMsgpackUint(br, 1<<(kind-0xcc))
+		if err != nil {
+			return 0, err
+		}
+		seconds = float64(n)
+	case kind >= 0xd0 && kind <= 0xd3:
+		size := 1 << (kind - 0xd0)
+		n, err := readMsgpackUint(br, size)
+		if err != nil {
+			return 0, err
+		}
+		// Sign-extend the big-endian integer from its size.
+		shift := 64 - 8*size
+		seconds = float64(int64(n<<shift) >> shift)
+	case kind >= 0xe0:
+		seconds = float64(int8(kind))
+	case kind == 0xca:
+		n, err := readMsgpackUint(br, 4)
+		if err != nil {
+			return 0, err
+		}
+		seconds = float64(math.Float32frombits(uint32(n)))
+	case kind == 0xcb:
+		n, err := readMsgpackUint(br, 8)
+		if err != nil {
+			return 0, err
+		}
+		seconds = math.Float64frombits(n)
+	default:
+		return 0, fmt.Errorf("%w: expected nil or number for expiry, got type 0x%02x", ErrInvalidSnapshot, kind)
+	}
+	if math.IsNaN(seconds) || seconds <= 0 {
+		// The item expired before any time the cache can tell.
+		return 1, nil
+	}
+	if seconds >= math.MaxInt64/1e9 {
+		return 0, nil
+	}
+	return int64(seconds * 1e9), nil
+}
+
+// readMsgpackUint reads a big-endian unsigned integer of size bytes.
+func readMsgpackUint(br *bufio.Reader, size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(br, buf[8-size:]); err != nil {
+		return 0, snapshotError(err)
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
@@ -0,0 +1,383 @@
+package infux
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// groupByShard groups keys by the shard they belong to.
+func (c *Cache) groupByShard(keys []string) map[*cacheShard][]string {
+	groups := make(map[*cacheShard][]string)
+	for _, key := range keys {
+		shard := c.getShard(key)
+		groups[shard] = append(groups[shard], key)
+	}
+	return groups
+}
+
+// GetMulti retrieves several items at once. It returns a map of the keys
+// that were found to their values; missing and expired keys are omitted.
+// Keys are grouped by shard so that each shard is locked only once,
+// however many of the keys it holds. Each shard is read atomically, but
+// the result as a whole is not a single point-in-time view. With
+// Config.KeyNormalizer, the result holds the keys as given.
+func (c *Cache) GetMulti(keys []string) map[string][]byte {
+	result := make(map[string][]byte, len(keys))
+	c.getMultiInto(keys, result)
+	return result
+}
+
+// GetMultiInto is like GetMulti, but stores the result in dst instead of
+// a new map, so that a hot loop can reuse one map across calls rather
+// than allocating one per call. dst is cleared first: once GetMultiInto
+// returns, it holds exactly the keys that were found, and keys missing
+// from the cache are absent from it, even if dst held them before. With
+// Config.KeyNormalizer, an intermediate map is still allocated.
+func (c *Cache) GetMultiInto(keys []string, dst map[string][]byte) {
+	clear(dst)
+	c.getMultiInto(keys, dst)
+}
+
+// getMultiInto adds the items found under keys to result.
+func (c *Cache) getMultiInto(keys []string, result map[string][]byte) {
+	if c.normalizeKey == nil {
+		c.getMulti(keys, result)
+		return
+	}
+	normalized := c.normalizeAll(keys)
+	found := make(map[string][]byte, len(keys))
+	c.getMulti(normalized, found)
+	for i, key := range keys {
+		if value, ok := found[normalized[i]]; ok {
+			result[key] = value
+		}
+	}
+}
+
+// getMulti implements GetMulti for normalized keys, adding the items
+// found to result.
+func (c *Cache) getMulti(keys []string, result map[string][]byte) {
+	c.getEach(keys, func(i int, value []byte) {
+		result[keys[i]] = value
+	})
+}
+
+// GetManyOrdered retrieves several items at once, like GetMulti, but
+// returns their values and whether each was found in slices aligned with
+// keys: values[i] and found[i] are the result for keys[i], with values[i]
+// nil for a missing or expired key. A key given several times gets a
+// result at each of its positions.
+func (c *Cache) GetManyOrdered(keys []string) (values [][]byte, found []bool) {
+	values, found = make([][]byte, len(keys)), make([]bool, len(keys))
+	if c.normalizeKey != nil {
+		keys = c.normalizeAll(keys)
+	}
+	c.getEach(keys, func(i int, value []byte) {
+		values[i], found[i] = value, true
+	})
+	return values, found
+}
+
+// GetFirst looks up keys in order and returns the first one present,
+// with its value, for example to fall back from an environment-specific
+// key to a default one. It stops at the first hit, without locking the
+// shards of the remaining keys. Every key it tries counts as a lookup,
+// hit or miss, as with Get, but misses never call the Loader. It returns
+// found false, with an empty key, if none of the keys is present. With
+// Config.KeyNormalizer, the key returned is the key as given.
+func (c *Cache) GetFirst(keys ...string) (key string, value []byte, found bool) {
+	for _, key := range keys {
+		if e, found := c.lookup(c.normalize(key)); found {
+			return key, c.valueOut(e), true
+		}
+	}
+	return "", nil, false
+}
+
+// getEach looks up the normalized keys, calling fn with the index in keys
+// and the value of each key found. Rather than grouping the keys in a map
+// of slices, as groupByShard does, it sorts them by shard index in a
+// single slice, which saves an allocation per shard for the small key
+// sets typical of hot loops.
+func (c *Cache) getEach(keys []string, fn func(i int, value []byte)) {
+	type shardKey struct {
+		index uint64
+		pos   int
+	}
+	table := c.table()
+	sorted := make([]shardKey, len(keys))
+	for i, key := range keys {
+		sorted[i] = shardKey{c.hash(key) & table.mask, i}
+	}
+	for len(sorted) > 0 {
+		var moved []shardKey
+		slices.SortFunc(sorted, func(a, b shardKey) int { return cmp.Compare(a.index, b.index) })
+		for len(sorted) > 0 {
+			n := 1
+			for n < len(sorted) && sorted[n].index == sorted[0].index {
+				n++
+			}
+			group := sorted[:n]
+			sorted = sorted[n:]
+			shard := table.shards[group[0].index]
+			write := c.lockLookup(shard)
+			if shard.moved {
+				c.unlockLookup(shard, write)
+				moved = append(moved, group...)
+				continue
+			}
+			for _, k := range group {
+				if e, found := c.lookupLocked(shard, keys[k.pos], write); found {
+					fn(k.pos, c.valueOut(e))
+				}
+			}
+			c.unlockLookup(shard, write)
+		}
+		// Keys of shards moved by a concurrent Resize are grouped again
+		// by their new shards.
+		table = c.table()
+		for i := range moved {
+			moved[i].index = c.hash(keys[moved[i].pos]) & table.mask
+		}
+		sorted = moved
+	}
+}
+
+// SetMulti adds several items at once, replacing any existing items. The
+// items never expire. Keys are grouped by shard so that each shard is
+// locked only once, however many of the items it receives. Each shard is
+// updated atomically, but other goroutines may observe some shards
+// updated before others. SetMulti is a no-op on a closed cache.
+func (c *Cache) SetMulti(items map[string][]byte) {
+	c.SetMultiWithTTL(items, 0)
+}
+
+// SetMultiWithTTL is like SetMulti, but the items expire after ttl. The
+// expiry time is computed once, so all the items share the same deadline
+// however long the writes take, before Config.TTLJitter is applied to
+// each item. A zero or negative ttl means the items never expire. It is
+// much faster than calling SetWithTTL in a loop, for example to warm a
+// cache.
+func (c *Cache) SetMultiWithTTL(items map[string][]byte, ttl time.Duration) {
+	if c.writeErr() != nil {
+		return
+	}
+	c.setEntries(c.multiEntries(c.normalizeItems(items), ttl))
+}
+
+// SetMultiChecked is like SetMulti, but validates every item before
+// writing any, and returns an error naming the first offending key, in
+// sorted order, if the cache would reject one of them: ErrTooLarge if its
+// value exceeds Config.MaxValueBytes, or if the item on its own exceeds
+// MaxBytes or MaxCost, as TrySet reports. The batch is then left out
+// entirely rather than landing in part. Only the validation is atomic:
+// once it passes, the items are written shard by shard as by SetMulti,
+// so other goroutines may observe some shards updated before others, and
+// an item may still be dropped by TinyLFU admission or by limits lowered
+// concurrently. It returns ErrClosed on a closed cache and ErrFrozen on a
+// frozen one.
+func (c *Cache) SetMultiChecked(items map[string][]byte) error {
+	return c.setMultiChecked(c.normalizeItems(items))
+}
+
+// setMultiChecked implements SetMultiChecked for items with normalized
+// keys.
+func (c *Cache) setMultiChecked(items map[string][]byte) error {
+	if err := c.writeErr(); err != nil {
+		return err
+	}
+	entries := c.multiEntries(items, 0)
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := c.checkLimits(entries[key]); err != nil {
+			return err
+		}
+	}
+	c.setEntries(entries)
+	return nil
+}
+
+// checkLimits returns the error TrySet would return for e, if its value
+// or size exceeds the cache's limits.
+func (c *Cache) checkLimits(e *entry) error {
+	if c.maxValueBytes > 0 && len(e.value) > c.maxValueBytes {
+		return fmt.Errorf("%w: key %q: value of %d bytes exceeds MaxValueBytes of %d", ErrTooLarge, e.key, len(e.value), c.maxValueBytes)
+	}
+	if maxBytes := c.maxBytes.Load(); maxBytes > 0 && e.size() > maxBytes {
+		return fmt.Errorf("%w: key %q: item of %d bytes exceeds MaxBytes of %d", ErrTooLarge, e.key, e.size(), maxBytes)
+	}
+	if maxCost := c.maxCost.Load(); maxCost > 0 && e.weight() > maxCost {
+		return fmt.Errorf("%w: key %q: item of cost %d exceeds MaxCost of %d", ErrTooLarge, e.key, e.weight(), maxCost)
+	}
+	return nil
+}
+
+// multiEntries returns the entries SetMultiWithTTL stores for items, by
+// key, which must be normalized. The expiry time is computed once for all
+// of them.
+func (c *Cache) multiEntries(items map[string][]byte, ttl time.Duration) map[string]*entry {
+	var deadline entry
+	deadline.setTTL(ttl, c.now())
+	entries := make(map[string]*entry, len(items))
+	for key, value := range items {
+		e := c.newEntry(key, value).keepExpiry(&deadline)
+		c.jitter(e)
+		entries[key] = e
+	}
+	return entries
+}
+
+// setEntries stores entries, locking each shard once.
+func (c *Cache) setEntries(entries map[string]*entry) {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	for len(keys) > 0 {
+		var moved []string
+		for shard, group := range c.groupByShard(keys) {
+			shard.mu.Lock()
+			if shard.moved {
+				shard.mu.Unlock()
+				moved = append(moved, group...)
+				continue
+			}
+			for _, key := range group {
+				c.insertLocked(shard, entries[key])
+			}
+			c.unlock(shard)
+			c.evictOverflow(shard)
+		}
+		// Keys of shards moved by a concurrent Resize are grouped again
+		// by their new shards.
+		keys = moved
+	}
+}
+
+// SetMultiReturningEvicted is like SetMulti, but returns the keys of the
+// items evicted to make room for the new ones, as reported to OnEvict
+// with ReasonEvicted, for example to propagate the invalidations to
+// another system. Keys are written in sorted order, one shard after
+// another in shard index order, so without concurrent writes, the keys
+// evicted only depend on the items, the cache's contents and its
+// eviction policy; they are returned in the order they were evicted, and
+// may include keys of items itself evicted by later items. The result is
+// empty if the cache has no limits or nothing needed to be evicted.
+// Evictions caused meanwhile by concurrent writes to other shards are not
+// included. SetMultiReturningEvicted returns nil on a closed cache.
+func (c *Cache) SetMultiReturningEvicted(items map[string][]byte) []string {
+	if c.writeErr() != nil {
+		return nil
+	}
+	items = c.normalizeItems(items)
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var evicted []string
+	for len(keys) > 0 {
+		var moved []string
+		table := c.table()
+		groups := make([][]string, len(table.shards))
+		for _, key := range keys {
+			i := c.hash(key) & table.mask
+			groups[i] = append(groups[i], key)
+		}
+		for i, group := range groups {
+			if len(group) == 0 {
+				continue
+			}
+			shard := table.shards[i]
+			shard.mu.Lock()
+			if shard.moved {
+				shard.mu.Unlock()
+				moved = append(moved, group...)
+				continue
+			}
+			shard.capture = &evicted
+			for _, key := range group {
+				c.insertLocked(shard, c.newEntry(key, items[key]))
+			}
+			shard.capture = nil
+			c.unlock(shard)
+			if c.overLimit() {
+				c.evictOthers(shard, &evicted)
+			}
+		}
+		// Keys of shards moved by a concurrent Resize are grouped again
+		// by their new shards.
+		keys = moved
+	}
+	return evicted
+}
+
+// normalizeItems returns items with their keys normalized, as given by
+// Config.KeyNormalizer.
+func (c *Cache) normalizeItems(items map[string][]byte) map[string][]byte {
+	if c.normalizeKey == nil {
+		return items
+	}
+	normalized := make(map[string][]byte, len(items))
+	for key, value := range items {
+		normalized[c.normalizeKey(key)] = value
+	}
+	return normalized
+}
+
+// DeleteMulti removes several items at once, and returns the number of
+// live items it removed. Keys are grouped by shard so that each shard is
+// locked only once, however many of the keys it holds; each shard is
+// updated atomically. Like Delete, it does not call OnEvict, and expired
+// items it removes are not counted. DeleteMulti returns 0 on a closed
+// cache.
+func (c *Cache) DeleteMulti(keys []string) int {
+	if c.writeErr() != nil {
+		return 0
+	}
+	if c.normalizeKey != nil {
+		keys = c.normalizeAll(keys)
+	}
+	return c.deleteKeys(keys, nil)
+}
+
+// deleteKeys implements DeleteMulti for normalized keys, deleting only
+// the items match accepts, or all of them if match is nil.
+func (c *Cache) deleteKeys(keys []string, match func(e *entry) bool) int {
+	removed := 0
+	for len(keys) > 0 {
+		var moved []string
+		for shard, group := range c.groupByShard(keys) {
+			shard.mu.Lock()
+			if shard.moved {
+				shard.mu.Unlock()
+				moved = append(moved, group...)
+				continue
+			}
+			now := c.now()
+			for _, key := range group {
+				e, found := shard.items[key]
+				switch {
+				case !found, match != nil && !match(e):
+				case e.expired(now):
+					c.removeLocked(shard, e)
+				default:
+					c.deleteLocked(shard, e)
+					removed++
+				}
+			}
+			c.unlock(shard)
+		}
+		// Keys of shards moved by a concurrent Resize are grouped again
+		// by their new shards.
+		keys = moved
+	}
+	return removed
+}
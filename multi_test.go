@@ -0,0 +1,35 @@
+package infux
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetManyOrdered(t *testing.T) {
+	c, clk := newTestCache(Config{Shards: 4, KeyNormalizer: strings.ToLower})
+	for i := 0; i < 20; i++ {
+		c.Set(fmt.Sprint("k", i), []byte(fmt.Sprint("v", i)))
+	}
+	c.SetWithTTL("expiring", []byte("x"), time.Second)
+	clk.Advance(time.Second)
+
+	keys := []string{"k3", "missing", "K3", "k17", "expiring", "k0", "k3"}
+	values, found := c.GetManyOrdered(keys)
+	want := []string{"v3", "", "v3", "v17", "", "v0", "v3"}
+	if len(values) != len(keys) || len(found) != len(keys) {
+		t.Fatalf("got %d values and %d found for %d keys", len(values), len(found), len(keys))
+	}
+	for i, key := range keys {
+		if found[i] != (want[i] != "") || string(values[i]) != want[i] {
+			t.Errorf("result %d for %q = %q, %v, want %q", i, key, values[i], found[i], want[i])
+		}
+		if !found[i] && values[i] != nil {
+			t.Errorf("result %d for missing %q has value %q, want nil", i, key, values[i])
+		}
+	}
+	if values, found := c.GetManyOrdered(nil); len(values) != 0 || len(found) != 0 {
+		t.Fatal("GetManyOrdered(nil) returned results")
+	}
+}
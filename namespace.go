@@ -0,0 +1,71 @@
+package infux
+
+import (
+	"strconv"
+	"time"
+)
+
+// Namespace is a view of a Cache that isolates its keys from those of
+// other namespaces while sharing the cache's shards, limits and
+// statistics. It is safe for concurrent use.
+//
+// Keys are stored in the parent cache as the namespace name prefixed with
+// its length, followed by the key, for example "5:users" + key for the
+// namespace "users". The length prefix guarantees that two different
+// namespaces can never produce the same stored key, even when one name is
+// a prefix of the other. Keys written directly to the parent cache should
+// not use this format.
+type Namespace struct {
+	cache  *Cache
+	prefix string
+}
+
+// Namespace returns a view of the cache whose keys are isolated under
+// name. Namespaces are cheap to create; calling Namespace twice with the
+// same name returns two views of the same keys.
+func (c *Cache) Namespace(name string) *Namespace {
+	return &Namespace{
+		cache:  c,
+		prefix: strconv.Itoa(len(name)) + ":" + name,
+	}
+}
+
+// key returns the key under which key is stored in the parent cache.
+func (n *Namespace) key(key string) string {
+	return n.prefix + key
+}
+
+// Set adds an item to the namespace, replacing any existing item.
+func (n *Namespace) Set(key string, value []byte) {
+	n.cache.Set(n.key(key), value)
+}
+
+// SetWithTTL adds an item to the namespace that expires after ttl.
+func (n *Namespace) SetWithTTL(key string, value []byte, ttl time.Duration) {
+	n.cache.SetWithTTL(n.key(key), value, ttl)
+}
+
+// Get retrieves an item from the namespace.
+func (n *Namespace) Get(key string) ([]byte, bool) {
+	return n.cache.Get(n.key(key))
+}
+
+// Delete removes an item from the namespace.
+func (n *Namespace) Delete(key string) {
+	n.cache.Delete(n.key(key))
+}
+
+// Has checks if a key exists in the namespace.
+func (n *Namespace) Has(key string) bool {
+	return n.cache.Has(n.key(key))
+}
+
+// Clear removes every item in the namespace, leaving other namespaces and
+// the rest of the cache untouched, and returns the number of items
+// removed. Like DeletePrefix, it scans the whole cache. With a
+// Config.KeyNormalizer, the prefix is normalized like the keys of Set, so
+// it matches them as long as the normalizer maps the prefix of a key to
+// the prefix of its normalized form, as case folding does.
+func (n *Namespace) Clear() int {
+	return n.cache.DeletePrefix(n.cache.normalize(n.prefix))
+}
@@ -0,0 +1,36 @@
+package infux
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNamespaceIsolation(t *testing.T) {
+	c := New()
+	a, b := c.Namespace("a"), c.Namespace("ab")
+	a.Set("bc", []byte("1"))
+	b.Set("c", []byte("2"))
+	if v, _ := a.Get("bc"); string(v) != "1" {
+		t.Fatalf("a.Get = %q, want 1", v)
+	}
+	if v, _ := b.Get("c"); string(v) != "2" {
+		t.Fatalf("b.Get = %q, want 2", v)
+	}
+	if n := a.Clear(); n != 1 || !b.Has("c") {
+		t.Fatalf("a.Clear removed %d items, or b's item, want only a's", n)
+	}
+}
+
+func TestNamespaceClearWithNormalizer(t *testing.T) {
+	c := NewWithConfig(Config{KeyNormalizer: strings.ToLower})
+	ns := c.Namespace("User")
+	ns.Set("One", []byte("1"))
+	ns.Set("two", []byte("2"))
+	c.Set("other", []byte("3"))
+	if n := ns.Clear(); n != 2 {
+		t.Fatalf("Clear removed %d items, want 2", n)
+	}
+	if ns.Has("one") || !c.Has("other") {
+		t.Fatal("Clear did not remove exactly the namespace's items")
+	}
+}
@@ -0,0 +1,26 @@
+package infux
+
+// knownMissing reports whether key has an unexpired tombstone in shard.
+func (c *Cache) knownMissing(shard *cacheShard, key string) bool {
+	if c.negativeTTL == 0 {
+		return false
+	}
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	expiresAt, found := shard.negative[key]
+	return found && c.now() < expiresAt
+}
+
+// rememberMissing records a tombstone for key in shard, if negative
+// caching is enabled.
+func (c *Cache) rememberMissing(shard *cacheShard, key string) {
+	if c.negativeTTL == 0 || c.closed.Load() {
+		return
+	}
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if shard.negative == nil {
+		shard.negative = make(map[string]int64)
+	}
+	shard.negative[key] = c.now() + int64(c.negativeTTL)
+}
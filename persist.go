@@ -0,0 +1,116 @@
+package infux
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPersistInterval is how often a cache with PersistConfig.Path set
+// writes its snapshot file, if PersistConfig.Interval is not set.
+const DefaultPersistInterval = time.Second
+
+// PersistConfig configures the persistence of a cache to a snapshot file,
+// as set with Config.Persist.
+type PersistConfig struct {
+	// Path is the snapshot file. If it is empty, the default, the cache
+	// is not persisted. The file must not be shared with another cache.
+	Path string
+	// Interval is how often the snapshot file is brought up to date, or
+	// DefaultPersistInterval if zero or negative.
+	Interval time.Duration
+}
+
+// persister tracks whether a persisted cache has changed since its
+// snapshot file was last written.
+type persister struct {
+	path     string
+	interval time.Duration
+	dirty    atomic.Bool
+}
+
+// markDirty records that the contents of the cache changed, for
+// Config.Persist. It is called under the shard's write lock by every
+// write, removal and expiry change, so it only writes the flag when it is
+// not already set: later writes until the next flush only read it.
+func (c *Cache) markDirty() {
+	if p := c.persist; p != nil && !p.dirty.Load() {
+		p.dirty.Store(true)
+	}
+}
+
+// loadPersisted restores the items of the snapshot file, if it exists,
+// logging any other error to Config.Logger.
+func (c *Cache) loadPersisted() {
+	f, err := os.Open(c.persist.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err == nil {
+		err = c.Restore(f)
+		f.Close()
+	}
+	if err != nil {
+		c.logger.Error("infux: restoring snapshot file failed", "path", c.persist.path, "err", err)
+	}
+}
+
+// runPersist writes the snapshot file every interval if the cache has
+// changed meanwhile, and once more when stop is closed, so that a burst
+// of writes costs a single write of the file.
+func (c *Cache) runPersist(stop <-chan struct{}) {
+	ticker := time.NewTicker(c.persist.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.flushPersisted()
+		case <-stop:
+			c.flushPersisted()
+			return
+		}
+	}
+}
+
+// flushPersisted writes the snapshot file if the cache has changed since
+// it was last written. On failure, the error is logged to Config.Logger
+// and the write is retried at the next interval.
+func (c *Cache) flushPersisted() {
+	if !c.persist.dirty.Swap(false) {
+		return
+	}
+	if err := c.writeSnapshotFile(c.persist.path); err != nil {
+		c.persist.dirty.Store(true)
+		c.logger.Error("infux: writing snapshot file failed", "path", c.persist.path, "err", err)
+	}
+}
+
+// writeSnapshotFile writes a snapshot of the cache to a temporary file
+// next to path and renames it to path once synced, so that a crash while
+// writing leaves the previous snapshot in place. Snapshot copies the
+// items of one shard at a time under its read lock and writes them
+// outside of it, so writes to the cache are not blocked by the disk.
+func (c *Cache) writeSnapshotFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	err = c.Snapshot(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
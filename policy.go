@@ -0,0 +1,156 @@
+package infux
+
+// EvictionPolicy selects which items a bounded cache evicts when it
+// exceeds Config.MaxEntries, Config.MaxBytes or Config.MaxCost.
+// Whatever the policy, eviction decisions are made within a single
+// shard.
+type EvictionPolicy int
+
+const (
+	// PolicyLRU evicts the least recently used item of the shard.
+	PolicyLRU EvictionPolicy = iota
+
+	// PolicyLFU evicts the least frequently used item among the
+	// lfuCandidates least recently used items of the shard, preferring
+	// the least recent one on a tie. It keeps items that are read often,
+	// even if not recently, that PolicyLRU would evict.
+	//
+	// Each item counts its hits. To keep items that were popular long ago
+	// from staying forever, the counters of a shard are halved every time
+	// the shard has served lfuAgingFactor hits per item it holds, so old
+	// popularity fades away exponentially as new hits accumulate.
+	PolicyLFU
+
+	// PolicyFIFO evicts the item of the shard that was set the longest
+	// time ago, regardless of how often it is read. Lookups do no
+	// bookkeeping, so unlike with the other policies they only take a
+	// shard's read lock unless Config.SlidingExpiration is set.
+	PolicyFIFO
+)
+
+const (
+	// lfuCandidates is the number of least recently used entries that
+	// PolicyLFU compares when choosing a victim.
+	lfuCandidates = 8
+
+	// lfuAgingFactor is the number of hits per entry, on average, after
+	// which a shard's LFU counters are halved. lfuMinAging is the minimum
+	// number of hits between agings, for small shards.
+	lfuAgingFactor = 10
+	lfuMinAging    = 1024
+)
+
+// accessLocked records a hit on e for the eviction policy. The cache must
+// be bounded, and the caller must hold the shard's write lock unless the
+// policy is PolicyFIFO, which records nothing, or the cache uses sampled
+// eviction, which records hits atomically.
+func (c *Cache) accessLocked(shard *cacheShard, e *entry) {
+	if c.policy == PolicyFIFO {
+		return
+	}
+	if c.sampled > 0 {
+		e.atime.Store(c.now())
+		if c.policy == PolicyLFU {
+			e.hit()
+		}
+		return
+	}
+	shard.lru.moveToFront(e)
+	if c.policy != PolicyLFU {
+		return
+	}
+	e.hit()
+	shard.accesses++
+	if shard.accesses >= max(lfuAgingFactor*len(shard.items), lfuMinAging) {
+		shard.accesses = 0
+		ageLocked(shard)
+	}
+}
+
+// hit increments the access count of e, saturating at its maximum.
+func (e *entry) hit() {
+	for {
+		freq := e.freq.Load()
+		if freq == ^uint32(0) || e.freq.CompareAndSwap(freq, freq+1) {
+			return
+		}
+	}
+}
+
+// ageLocked halves the access counts of the entries of shard. The caller
+// must hold the shard's write lock.
+func ageLocked(shard *cacheShard) {
+	for _, e := range shard.items {
+		e.freq.Store(e.freq.Load() / 2)
+	}
+}
+
+// victimLocked returns the entry of shard that the eviction policy would
+// evict, never choosing keep, or nil if there is none. The caller must
+// hold the shard's write lock.
+func (c *Cache) victimLocked(shard *cacheShard, keep *entry) *entry {
+	if c.sampled > 0 {
+		return c.sampleVictimLocked(shard, keep)
+	}
+	if c.policy != PolicyLFU {
+		if victim := shard.lru.back(); victim != keep {
+			return victim
+		}
+		return nil
+	}
+	var victim *entry
+	seen := 0
+	for e := shard.lru.back(); e != nil && e != &shard.lru.root && seen < lfuCandidates; e = e.prev {
+		if e == keep {
+			continue
+		}
+		if victim == nil || e.freq.Load() < victim.freq.Load() {
+			victim = e
+		}
+		seen++
+	}
+	return victim
+}
+
+// sampleVictimLocked chooses the victim for sampled eviction among
+// Config.EvictionSampleSize entries of shard, taken from a random point of
+// the shard's map: the least recently used one, or with PolicyLFU the
+// least frequently used one, or with PolicyFIFO the oldest one. With
+// PolicyLFU, the shard's access counts are halved every time it has
+// evicted as many entries as it holds. The caller must hold the shard's
+// write lock.
+func (c *Cache) sampleVictimLocked(shard *cacheShard, keep *entry) *entry {
+	var victim *entry
+	seen := 0
+	for _, e := range shard.items {
+		if seen == c.sampled {
+			break
+		}
+		if e == keep {
+			continue
+		}
+		if victim == nil || c.lessUsed(e, victim) {
+			victim = e
+		}
+		seen++
+	}
+	if victim != nil && c.policy == PolicyLFU {
+		shard.accesses++
+		if shard.accesses >= len(shard.items) {
+			shard.accesses = 0
+			ageLocked(shard)
+		}
+	}
+	return victim
+}
+
+// lessUsed reports whether sampled eviction should prefer evicting a over
+// b.
+func (c *Cache) lessUsed(a, b *entry) bool {
+	if c.policy == PolicyLFU {
+		if fa, fb := a.freq.Load(), b.freq.Load(); fa != fb {
+			return fa < fb
+		}
+	}
+	return a.atime.Load() < b.atime.Load()
+}
@@ -0,0 +1,125 @@
+package infux
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPolicyFIFOEvictsOldestInsertion(t *testing.T) {
+	for _, tc := range []struct {
+		policy  EvictionPolicy
+		evicted string
+	}{
+		{PolicyLRU, "b"},
+		{PolicyFIFO, "a"},
+	} {
+		c := NewWithConfig(Config{Shards: 1, MaxEntries: 2, EvictionPolicy: tc.policy})
+		c.Set("a", []byte("1"))
+		c.Set("b", []byte("2"))
+		c.Get("a")
+		c.Set("c", []byte("3"))
+		if c.Has(tc.evicted) {
+			t.Errorf("policy %d kept %q, want it evicted", tc.policy, tc.evicted)
+		}
+		if c.Len() != 2 {
+			t.Errorf("policy %d: Len = %d, want 2", tc.policy, c.Len())
+		}
+	}
+}
+
+// BenchmarkBoundedGet measures parallel reads of a bounded cache, which
+// with PolicyLRU take the shard's write lock to move the item to the
+// front of its list, and with PolicyFIFO only the read lock.
+func BenchmarkBoundedGet(b *testing.B) {
+	for _, policy := range []struct {
+		name   string
+		policy EvictionPolicy
+	}{{"LRU", PolicyLRU}, {"FIFO", PolicyFIFO}} {
+		b.Run(policy.name, func(b *testing.B) {
+			c := NewWithConfig(Config{MaxEntries: 1 << 16, EvictionPolicy: policy.policy})
+			keys := make([]string, 1<<10)
+			for i := range keys {
+				keys[i] = fmt.Sprint(i)
+				c.Set(keys[i], []byte("v"))
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					c.Get(keys[i%len(keys)])
+				}
+			})
+		})
+	}
+}
+
+func TestRecencySampleRateStillPromotesHotKeys(t *testing.T) {
+	c := NewWithConfig(Config{Shards: 1, MaxEntries: 2, RecencySampleRate: 0.01})
+	c.Set("hot", []byte("1"))
+	c.Set("cold", []byte("2"))
+	// With 1% of hits sampled, 2000 hits all go unsampled with
+	// probability 0.99^2000, about 2e-9.
+	for i := 0; i < 2000; i++ {
+		c.Get("hot")
+	}
+	c.Set("new", []byte("3"))
+	if !c.Has("hot") || c.Has("cold") {
+		t.Fatal("sampled recency did not keep the hot key over the cold one")
+	}
+}
+
+// BenchmarkRecencySampleRate measures parallel reads of an LRU cache
+// when every hit takes the write lock to update recency and when only 1%
+// of them do.
+func BenchmarkRecencySampleRate(b *testing.B) {
+	for _, rate := range []float64{0, 0.01} {
+		b.Run(fmt.Sprintf("rate=%g", rate), func(b *testing.B) {
+			c := NewWithConfig(Config{MaxEntries: 1 << 16, RecencySampleRate: rate})
+			keys := make([]string, 1<<10)
+			for i := range keys {
+				keys[i] = fmt.Sprint(i)
+				c.Set(keys[i], []byte("v"))
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					c.Get(keys[i%len(keys)])
+				}
+			})
+		})
+	}
+}
+
+// hotSurvivors fills a cache of 1000 items sampling sampleSize of them
+// per eviction, reads the first 500, then writes 500 new items, and
+// returns how many of the 500 read items are still cached.
+func hotSurvivors(sampleSize int) int {
+	c, clk := newTestCache(Config{Shards: 1, MaxEntries: 1000, EvictionSampleSize: sampleSize})
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint("old-", i), []byte("v"))
+	}
+	clk.Advance(time.Second)
+	for i := 0; i < 500; i++ {
+		c.Get(fmt.Sprint("old-", i))
+	}
+	clk.Advance(time.Second)
+	for i := 0; i < 500; i++ {
+		c.Set(fmt.Sprint("new-", i), []byte("v"))
+	}
+	var kept int
+	for i := 0; i < 500; i++ {
+		if c.Has(fmt.Sprint("old-", i)) {
+			kept++
+		}
+	}
+	return kept
+}
+
+func TestSampledEvictionApproximatesLRU(t *testing.T) {
+	// Evicting at random keeps about half of the read items; sampling 16
+	// items per eviction keeps over 80% of them on average.
+	random, sampled := hotSurvivors(1), hotSurvivors(16)
+	if sampled < 350 || sampled <= random {
+		t.Fatalf("sampled eviction kept %d of 500 recently read items, random eviction %d", sampled, random)
+	}
+}
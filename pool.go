@@ -0,0 +1,157 @@
+package infux
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// Values stored with Config.PooledValues are copied into buffers whose
+// capacity is a power of two between poolMinSize and poolMaxSize bytes.
+// Longer values get their own allocation, shorter ones a poolMinSize
+// buffer.
+const (
+	poolMinShift = 6
+	poolMaxShift = 20
+	poolMinSize  = 1 << poolMinShift
+	poolMaxSize  = 1 << poolMaxShift
+)
+
+// valuePools holds the free buffers of each size class, shared by all
+// caches.
+var valuePools [poolMaxShift - poolMinShift + 1]sync.Pool
+
+// pooledValue is a buffer from valuePools holding a stored value, with a
+// reference count: one for the cache while it stores the value, and one
+// for every Value handed out by GetRef and not yet released. The buffer
+// returns to its pool once the count drops to zero, and no sooner, so
+// that no reader can see it reused for another value.
+type pooledValue struct {
+	buf   []byte
+	class int
+	refs  atomic.Int32
+}
+
+// newPooledValue returns a pooled buffer, referenced once, and the copy
+// of value in it, or nil and nil if value is too long to be pooled.
+func newPooledValue(value []byte) (*pooledValue, []byte) {
+	if len(value) > poolMaxSize {
+		return nil, nil
+	}
+	class := 0
+	if len(value) > poolMinSize {
+		class = bits.Len(uint(len(value)-1)) - poolMinShift
+	}
+	p, _ := valuePools[class].Get().(*pooledValue)
+	if p == nil {
+		p = &pooledValue{buf: make([]byte, poolMinSize<<class), class: class}
+	}
+	p.refs.Store(1)
+	n := copy(p.buf, value)
+	// Cap the copy at its length, so that appending to it cannot write
+	// over the rest of the buffer.
+	return p, p.buf[:n:n]
+}
+
+// acquire adds a reference to p, which must already have one.
+func (p *pooledValue) acquire() {
+	p.refs.Add(1)
+}
+
+// release drops a reference to p, returning its buffer to the pool if it
+// was the last one.
+func (p *pooledValue) release() {
+	if p.refs.Add(-1) == 0 {
+		valuePools[p.class].Put(p)
+	}
+}
+
+// pinned returns an entry whose value stays valid once the shard's lock
+// is released and e is removed from the cache: e itself, unless its value
+// is in a pooled buffer, in which case an entry holding e's key and a
+// private copy of its value. The caller must hold at least the shard's
+// read lock.
+func (e *entry) pinned() *entry {
+	if e.pool == nil {
+		return e
+	}
+	return &entry{key: e.key, value: cloneBytes(e.value)}
+}
+
+// Value is a reference to a stored value, returned by GetRef, that lets
+// the caller read the value without copying it even with
+// Config.PooledValues, where the cache recycles the buffers of the values
+// it no longer stores. While the Value is not released, its buffer is
+// pinned: the cache may replace or remove the item, but does not reuse
+// the buffer. Release must be called exactly once, when the caller is
+// done with the bytes; a Value that is never released pins its buffer
+// until the garbage collector frees it, which defeats pooling but is
+// otherwise harmless, while using the bytes after Release, or releasing
+// twice, lets them change under the caller. Values of caches without
+// pooling, and values too long to be pooled, are not recycled, so
+// releasing them is a no-op.
+type Value struct {
+	b    []byte
+	pool *pooledValue
+}
+
+// Bytes returns the value. The caller must not modify it, nor use it
+// after calling Release.
+func (v Value) Bytes() []byte {
+	return v.b
+}
+
+// Release releases the reference, allowing the cache to recycle the
+// value's buffer once it no longer stores it.
+func (v Value) Release() {
+	if v.pool != nil {
+		v.pool.release()
+	}
+}
+
+// GetRef is like Get, but returns a reference to the value rather than
+// a copy of it. With Config.PooledValues, other reads copy values out of
+// their pooled buffers before returning, since the cache may recycle a
+// buffer as soon as the value is overwritten or removed; GetRef instead
+// pins the buffer until the returned Value is released, so that large
+// values can be read without copying. The Value must be released, also
+// without Config.PooledValues, where it simply holds the value Get would
+// return.
+func (c *Cache) GetRef(key string) (Value, bool) {
+	key = c.normalize(key)
+	c.recordLookup(key)
+	if c.bloomMiss(key) {
+		return c.loadRef(key)
+	}
+	shard, write := c.lockLookupShard(key)
+	e, found := c.lookupLocked(shard, key, write)
+	var v Value
+	switch {
+	case found && e.pool != nil:
+		e.pool.acquire()
+		v = Value{b: e.value, pool: e.pool}
+	case found:
+		v = Value{b: c.valueOut(e)}
+	}
+	stale := !found && c.expiredLocked(shard, key, write)
+	c.unlockLookup(shard, write)
+	if stale {
+		c.deleteIfExpired(key)
+	}
+	if found {
+		return v, true
+	}
+	return c.loadRef(key)
+}
+
+// loadRef implements GetRef on a miss.
+func (c *Cache) loadRef(key string) (Value, bool) {
+	if c.loader == nil {
+		return Value{}, false
+	}
+	value, err := c.load(key)
+	if err != nil {
+		return Value{}, false
+	}
+	return Value{b: c.copyOut(value)}, true
+}
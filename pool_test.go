@@ -0,0 +1,59 @@
+package infux
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestPooledForEachValuesSurviveOverwrite(t *testing.T) {
+	c := NewWithConfig(Config{PooledValues: true})
+	for i := 0; i < 100; i++ {
+		c.Set(fmt.Sprint(i), bytes.Repeat([]byte{'a'}, 100))
+	}
+	var seen [][]byte
+	c.ForEach(func(_ string, value []byte) bool {
+		seen = append(seen, value)
+		return true
+	})
+	// Overwriting recycles the old buffers into the new values.
+	for i := 0; i < 100; i++ {
+		c.Set(fmt.Sprint(i), bytes.Repeat([]byte{'b'}, 100))
+	}
+	for _, value := range seen {
+		if bytes.ContainsRune(value, 'b') {
+			t.Fatal("value passed to ForEach changed after an overwrite")
+		}
+	}
+}
+
+func TestGetRefPinsBuffer(t *testing.T) {
+	c := NewWithConfig(Config{PooledValues: true})
+	c.Set("k", []byte("first"))
+	v, ok := c.GetRef("k")
+	if !ok {
+		t.Fatal("GetRef missed")
+	}
+	c.Set("k", []byte("other"))
+	if string(v.Bytes()) != "first" {
+		t.Fatalf("pinned value changed to %q", v.Bytes())
+	}
+	if v.pool.refs.Load() != 1 {
+		t.Fatalf("pinned buffer has %d references, want 1", v.pool.refs.Load())
+	}
+	v.Release()
+	if got, _ := c.Get("k"); string(got) != "other" {
+		t.Fatalf("Get = %q, want other", got)
+	}
+}
+
+func TestClearReleasesPooledBuffers(t *testing.T) {
+	c := NewWithConfig(Config{PooledValues: true})
+	c.Set("k", []byte("value"))
+	shard := c.getShard("k")
+	p := shard.items["k"].pool
+	c.Clear()
+	if n := p.refs.Load(); n != 0 {
+		t.Fatalf("buffer has %d references after Clear, want 0", n)
+	}
+}
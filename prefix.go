@@ -0,0 +1,56 @@
+package infux
+
+import "strings"
+
+// DeletePrefix removes every item whose key starts with prefix and
+// returns the number of live items removed. Because keys with a common
+// prefix may live in any shard, DeletePrefix scans the whole cache,
+// holding each shard's write lock while that shard is scanned. It is O(n)
+// in the size of the cache and intended for infrequent administrative
+// operations, not hot paths. DeletePrefix returns 0 on a closed cache.
+func (c *Cache) DeletePrefix(prefix string) int {
+	if c.writeErr() != nil {
+		return 0
+	}
+	removed := 0
+	for _, shard := range c.table().shards {
+		removed += c.deletePrefixInShard(shard, prefix)
+	}
+	return removed
+}
+
+// deletePrefixInShard removes the items of shard whose key starts with
+// prefix and returns the number of live items removed.
+func (c *Cache) deletePrefixInShard(shard *cacheShard, prefix string) int {
+	shard.mu.Lock()
+	defer c.unlock(shard)
+	now := c.now()
+	removed := 0
+	for key, e := range shard.items {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if e.expired(now) {
+			c.removeLocked(shard, e)
+			continue
+		}
+		removed++
+		c.deleteLocked(shard, e)
+	}
+	return removed
+}
+
+// RangePrefix calls fn for each live item whose key starts with prefix,
+// in no particular order, until fn returns false, which stops the whole
+// iteration. Because keys with a common prefix may live in any shard, it
+// scans every shard, skipping non-matching keys with a plain prefix
+// comparison. Like ForEach, it holds one shard's read lock at a time,
+// while calling fn, so fn must not modify the cache.
+func (c *Cache) RangePrefix(prefix string, fn func(key string, value []byte) bool) {
+	c.ForEach(func(key string, value []byte) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return true
+		}
+		return fn(key, value)
+	})
+}
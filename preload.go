@@ -0,0 +1,25 @@
+package infux
+
+// Preload creates a new Cache with the default configuration and fills it
+// with items, which never expire. Keys are first grouped by shard so that
+// each shard's map is allocated at its final size, which avoids the
+// repeated growth and rehashing that calling Set in a loop incurs for
+// large loads. The values are stored without copying.
+func Preload(items map[string][]byte) *Cache {
+	c := New()
+	table := c.table()
+	groups := make([][]string, len(table.shards))
+	for key := range items {
+		i := c.hash(key) & table.mask
+		groups[i] = append(groups[i], key)
+	}
+	for i, shard := range table.shards {
+		shard.mu.Lock()
+		shard.items = make(map[string]*entry, len(groups[i]))
+		for _, key := range groups[i] {
+			c.insertLocked(shard, c.newEntry(key, items[key]))
+		}
+		c.unlock(shard)
+	}
+	return c
+}
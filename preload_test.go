@@ -0,0 +1,50 @@
+package infux
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPreload(t *testing.T) {
+	items := make(map[string][]byte, 10000)
+	for i := 0; i < 10000; i++ {
+		items[fmt.Sprint(i)] = []byte(fmt.Sprint("v", i))
+	}
+	c := Preload(items)
+	if c.Len() != len(items) {
+		t.Fatalf("Len = %d, want %d", c.Len(), len(items))
+	}
+	for key, want := range items {
+		if v, found := c.Get(key); !found || string(v) != string(want) {
+			t.Fatalf("Get(%q) = %q, %v, want %q", key, v, found, want)
+		}
+	}
+	if c.SizeBytes() == 0 {
+		t.Fatal("SizeBytes = 0 after Preload")
+	}
+}
+
+// BenchmarkPreload measures filling a new cache with 1<<20 items, with
+// Preload, which sizes each shard's map up front, and with a Set loop,
+// whose maps grow as they fill.
+func BenchmarkPreload(b *testing.B) {
+	items := make(map[string][]byte, 1<<20)
+	for i := 0; i < 1<<20; i++ {
+		items[fmt.Sprint(i)] = []byte("v")
+	}
+	b.Run("Preload", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			Preload(items)
+		}
+	})
+	b.Run("SetLoop", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			c := New()
+			for key, value := range items {
+				c.Set(key, value)
+			}
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package infux
+
+import "time"
+
+// GetFresh is like Get, but also reports whether the value is fresh. It
+// is not if the item is within Config.RefreshThreshold of its expiry
+// and a background refresh of it is underway, which the lookup itself
+// may have started: the value is then served stale until the refresh
+// stores its replacement, and a caller that cannot use a stale value
+// may wait for the refresh and look the key up again. Values of items
+// outside the refresh window, and values loaded on a miss, are always
+// fresh. The check is best-effort: a refresh finishing during the call
+// may leave an old value reported as fresh.
+func (c *Cache) GetFresh(key string) (value []byte, fresh bool, found bool) {
+	key = c.normalize(key)
+	if e, found := c.lookup(key); found {
+		_, refreshing := c.refreshing.Load(key)
+		return c.valueOut(e), !refreshing, true
+	}
+	if c.loader == nil {
+		return nil, false, false
+	}
+	value, err := c.load(key)
+	return c.copyOut(value), err == nil, err == nil
+}
+
+// getRefresh is like get, but also starts a background refresh of the
+// item found if it expires within Config.RefreshThreshold.
+func (c *Cache) getRefresh(key string) (*entry, bool) {
+	c.recordLookup(key)
+	if c.bloomMiss(key) {
+		return nil, false
+	}
+	shard, write := c.lockLookupShard(key)
+	e, found := c.lookupLocked(shard, key, write)
+	stale := !found && c.expiredLocked(shard, key, write)
+	var ttl time.Duration
+	if found && e.ttl > 0 && e.expiresAt-c.now() < int64(c.refreshThreshold) {
+		ttl = e.ttl
+	}
+	stored := e
+	if found {
+		e = e.pinned()
+	}
+	c.unlockLookup(shard, write)
+	if stale {
+		c.deleteIfExpired(key)
+	}
+	if ttl > 0 {
+		// refresh compares the stored entry, not the pinned copy.
+		c.refresh(shard, stored, ttl)
+	}
+	return e, found
+}
+
+// refresh reloads the item stored as e in shard through the Loader in a
+// new goroutine, and stores the result with ttl in place of e. At most
+// one refresh runs per key. If loading fails, or the item is rewritten or
+// removed in the meantime, nothing is stored, so the current value keeps
+// being served until it expires. Close waits for refreshes underway, and
+// none starts once the cache is closed.
+func (c *Cache) refresh(shard *cacheShard, e *entry, ttl time.Duration) {
+	if _, busy := c.refreshing.LoadOrStore(e.key, struct{}{}); busy {
+		return
+	}
+	started := c.startTask(func() {
+		defer c.refreshing.Delete(e.key)
+		value, err := c.callLoader(e.key)
+		if err != nil || c.writeErr() != nil {
+			return
+		}
+		next := c.newTTLEntry(e.key, value, ttl)
+		shard.mu.Lock()
+		if shard.items[e.key] == e {
+			c.insertLocked(shard, next)
+		}
+		c.unlock(shard)
+		c.evictOverflow(shard)
+	})
+	if !started {
+		c.refreshing.Delete(e.key)
+	}
+}
@@ -0,0 +1,72 @@
+package infux
+
+import (
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRefreshAheadStoresLoadedValue(t *testing.T) {
+	for _, pooled := range []bool{false, true} {
+		c, clk := newTestCache(Config{
+			PooledValues:     pooled,
+			RefreshThreshold: time.Minute,
+			Loader: func(key string) ([]byte, error) {
+				return []byte("new"), nil
+			},
+		})
+		c.SetWithTTL("k", []byte("old"), 2*time.Minute)
+		clk.Advance(90 * time.Second)
+		if v, _ := c.Get("k"); string(v) != "old" {
+			t.Fatalf("pooled=%v: Get = %q during refresh, want old", pooled, v)
+		}
+		waitFor(t, func() bool {
+			v, _ := c.Peek("k")
+			return string(v) == "new"
+		})
+		c.Close()
+	}
+}
+
+func TestCloseWaitsForRefresh(t *testing.T) {
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	c, clk := newTestCache(Config{
+		RefreshThreshold: time.Minute,
+		Loader: func(key string) ([]byte, error) {
+			close(loading)
+			<-release
+			return []byte("new"), nil
+		},
+	})
+	c.SetWithTTL("k", []byte("old"), 2*time.Minute)
+	clk.Advance(90 * time.Second)
+	c.Get("k")
+	<-loading
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while a refresh was loading")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+	if c.Len() != 0 {
+		t.Fatal("refresh stored its value after Close")
+	}
+}
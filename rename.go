@@ -0,0 +1,79 @@
+package infux
+
+// Rename moves the item stored under oldKey to newKey, replacing any item
+// stored under newKey, for example to promote "key.tmp" to "key". The item
+// keeps its value, expiry, tags, cost and access metadata, and other
+// goroutines observe the item under either key, never under both or
+// neither. Subscribers of oldKey receive EventDelete and those of newKey
+// EventSet. Rename locks the shards of both keys, in shard index order so
+// that concurrent renames cannot deadlock; if both keys belong to the same
+// shard, only that shard is locked. It reports false, changing nothing,
+// if oldKey is missing or expired, and also, after removing the item, if
+// the item no longer fits the cache's limits under newKey, as with Set.
+// Rename returns false on a closed cache, and renaming a key to itself
+// only reports whether it is present.
+func (c *Cache) Rename(oldKey, newKey string) bool {
+	if c.writeErr() != nil {
+		return false
+	}
+	oldKey, newKey = c.normalize(oldKey), c.normalize(newKey)
+	from, to := c.lockPair(oldKey, newKey)
+	e, found := c.liveLocked(from, oldKey)
+	renamed := found
+	if found && oldKey != newKey {
+		n := &entry{
+			key:        newKey,
+			value:      e.value,
+			compressed: e.compressed,
+			cost:       e.cost,
+			tags:       e.tags,
+			expiresAt:  e.expiresAt,
+			ttl:        e.ttl,
+			maxIdle:    e.maxIdle,
+			// The new entry takes over the old one's reference.
+			pool: e.pool,
+		}
+		e.pool = nil
+		n.usedAt.Store(e.usedAt.Load())
+		n.freq.Store(e.freq.Load())
+		n.hits.Store(e.hits.Load())
+		n.accessedAt.Store(e.accessedAt.Load())
+		// Remove the item first, so that making room for it under newKey
+		// cannot evict it under oldKey.
+		c.deleteLocked(from, e)
+		renamed = c.insertLocked(to, n)
+		n.writtenAt = e.writtenAt
+		n.atime.Store(e.atime.Load())
+	}
+	c.unlock(from)
+	if to != from {
+		c.unlock(to)
+	}
+	c.evictOverflow(to)
+	return renamed
+}
+
+// lockPair write-locks and returns the shards that a and b belong to,
+// locking the one with the lower index first, or only one if they are the
+// same. If Resize moved either shard meanwhile, it starts over.
+func (c *Cache) lockPair(a, b string) (*cacheShard, *cacheShard) {
+	for {
+		table := c.table()
+		i, j := c.hash(a)&table.mask, c.hash(b)&table.mask
+		first, second := table.shards[min(i, j)], table.shards[max(i, j)]
+		first.mu.Lock()
+		if first.moved {
+			first.mu.Unlock()
+			continue
+		}
+		if second != first {
+			second.mu.Lock()
+			if second.moved {
+				second.mu.Unlock()
+				first.mu.Unlock()
+				continue
+			}
+		}
+		return table.shards[i], table.shards[j]
+	}
+}
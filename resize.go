@@ -0,0 +1,186 @@
+package infux
+
+import (
+	"fmt"
+	"time"
+)
+
+// shardTable is the set of shards of a cache.
+type shardTable struct {
+	shards []*cacheShard
+	// mask is len(shards)-1 and maps a key hash to its shard index.
+	mask uint64
+}
+
+// newShardTable returns a table of n empty shards, whose locks spin
+// before blocking if spin is set. n must be a power of two.
+func newShardTable(n int, spin bool) *shardTable {
+	t := &shardTable{shards: make([]*cacheShard, n), mask: uint64(n - 1)}
+	for i := range t.shards {
+		t.shards[i] = newShard(spin)
+	}
+	return t
+}
+
+// shardFor returns the shard for a key with the given hash.
+func (t *shardTable) shardFor(hash uint64) *cacheShard {
+	return t.shards[hash&t.mask]
+}
+
+// table returns the current shard table. Operations that visit every
+// shard use the table current when they start; if Resize runs meanwhile,
+// they see the moved shards empty.
+func (c *Cache) table() *shardTable {
+	return c.tab.Load()
+}
+
+// lockShard write-locks and returns the shard that key belongs to. If
+// Resize moved that shard while lockShard waited for its lock, it moves
+// on to the key's new shard.
+func (c *Cache) lockShard(key string) *cacheShard {
+	for {
+		shard := c.getShard(key)
+		shard.mu.Lock()
+		if !shard.moved {
+			return shard
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// tryLockShard is like lockShard, but gives up at deadline, in wall
+// clock time, if the shard stays locked by others. sync.RWMutex has no
+// timed lock, so it polls TryLock, sleeping between attempts for twice
+// as long each time, from a microsecond up to a millisecond. It makes at
+// least one attempt, however early the deadline.
+func (c *Cache) tryLockShard(key string, deadline time.Time) (*cacheShard, bool) {
+	backoff := time.Microsecond
+	for {
+		shard := c.getShard(key)
+		if shard.mu.TryLock() {
+			if !shard.moved {
+				return shard, true
+			}
+			shard.mu.Unlock()
+			continue
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, false
+		}
+		time.Sleep(min(backoff, wait))
+		backoff = min(2*backoff, time.Millisecond)
+	}
+}
+
+// rlockShard is like lockShard, but read-locks the shard.
+func (c *Cache) rlockShard(key string) *cacheShard {
+	for {
+		shard := c.getShard(key)
+		shard.mu.RLock()
+		if !shard.moved {
+			return shard
+		}
+		shard.mu.RUnlock()
+	}
+}
+
+// lockLookupShard is like lockShard, but locks the shard with lockLookup,
+// and also returns its result.
+func (c *Cache) lockLookupShard(key string) (*cacheShard, bool) {
+	for {
+		shard := c.getShard(key)
+		write := c.lockLookup(shard)
+		if !shard.moved {
+			return shard, write
+		}
+		c.unlockLookup(shard, write)
+	}
+}
+
+// Resize changes the number of shards of the cache to n, which must be a
+// positive power of two, and rehashes every item into the new shards, so
+// that a cache whose traffic has outgrown its shard count can be given
+// more without being recreated. Items keep their values, expiry times and
+// costs, and the statistics are preserved. Resize locks every shard for
+// the whole rehash, so all other operations on the cache wait until it
+// completes; it is meant for rare maintenance, not for regular use.
+// Recency is kept within each new shard only approximately. Resize
+// returns an error if n is invalid, and ErrClosed on a closed cache.
+func (c *Cache) Resize(n int) error {
+	if !isPowerOfTwo(n) {
+		return fmt.Errorf("infux: shard count must be a positive power of two, got %d", n)
+	}
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	c.resizing.Lock()
+	defer c.resizing.Unlock()
+	old := c.table()
+	if len(old.shards) == n {
+		return nil
+	}
+	for _, shard := range old.shards {
+		shard.mu.Lock()
+	}
+	next := newShardTable(n, c.spinLocks)
+	for _, shard := range next.shards {
+		shard.bloom.Store(c.newBloomFilterForShard(n))
+	}
+	for _, shard := range old.shards {
+		c.moveShardLocked(shard, next)
+		c.retired.add(shard.stats.snapshot())
+		shard.reset()
+		shard.moved = true
+	}
+	c.tab.Store(next)
+	if c.maxShardEntries > 0 {
+		// Merged shards may hold more than the per-shard cap.
+		c.draining.Store(true)
+	}
+	for _, shard := range old.shards {
+		c.unlock(shard)
+	}
+	return nil
+}
+
+// moveShardLocked adds the items and tombstones of shard to the shards of
+// table, which no other goroutine uses yet, leaving shard unchanged.
+// The cache-wide totals are unaffected, as the items stay in the cache.
+// The caller must hold the shard's write lock.
+func (c *Cache) moveShardLocked(shard *cacheShard, table *shardTable) {
+	move := func(e *entry) {
+		dst := table.shardFor(c.hash(e.key))
+		dst.items[e.key] = e
+		dst.length.Add(1)
+		dst.size += e.size()
+		dst.valueSize += int64(len(e.value))
+		c.bloomAddLocked(dst, e.key)
+		if c.ordered {
+			dst.lru.pushFront(e)
+		}
+		e.bucket = 0
+		c.scheduleLocked(dst, e)
+	}
+	if c.ordered {
+		// Move the least recently used entries first, so that they end
+		// up at the back of their new lists.
+		for e := shard.lru.back(); e != nil && e != &shard.lru.root; {
+			prev := e.prev
+			shard.lru.remove(e)
+			move(e)
+			e = prev
+		}
+	} else {
+		for _, e := range shard.items {
+			move(e)
+		}
+	}
+	for key, expiresAt := range shard.negative {
+		dst := table.shardFor(c.hash(key))
+		if dst.negative == nil {
+			dst.negative = make(map[string]int64)
+		}
+		dst.negative[key] = expiresAt
+	}
+}
@@ -0,0 +1,87 @@
+package infux
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResizeKeepsItems(t *testing.T) {
+	c, clk := newTestCache(Config{Shards: 4, MaxEntries: 10000})
+	c.SetWithTTL("ttl", []byte("t"), time.Minute)
+	for i := 0; i < 1000; i++ {
+		c.Set(fmt.Sprint(i), []byte(fmt.Sprint(i)))
+	}
+	c.Get("0")
+	for _, n := range []int{64, 2, 16} {
+		if err := c.Resize(n); err != nil {
+			t.Fatalf("Resize(%d): %v", n, err)
+		}
+		if got := len(c.table().shards); got != n {
+			t.Fatalf("Resize(%d) left %d shards", n, got)
+		}
+		if c.Len() != 1001 {
+			t.Fatalf("Len = %d after Resize(%d), want 1001", c.Len(), n)
+		}
+		for i := 0; i < 1000; i++ {
+			if v, found := c.Get(fmt.Sprint(i)); !found || string(v) != fmt.Sprint(i) {
+				t.Fatalf("Get(%d) after Resize(%d) = %q, %v", i, n, v, found)
+			}
+		}
+	}
+	if hits := c.Stats().Hits; hits != 3001 {
+		t.Fatalf("Hits = %d, want the hits from before each resize kept", hits)
+	}
+	clk.Advance(time.Minute)
+	if c.Has("ttl") {
+		t.Fatal("Resize dropped the expiry of an item")
+	}
+}
+
+func TestResizeRejectsInvalidCounts(t *testing.T) {
+	c := NewWithShards(8)
+	for _, n := range []int{0, -4, 3, 100} {
+		if err := c.Resize(n); err == nil {
+			t.Fatalf("Resize(%d) succeeded", n)
+		}
+	}
+	if got := len(c.table().shards); got != 8 {
+		t.Fatalf("invalid Resize changed the shard count to %d", got)
+	}
+	c.Close()
+	if err := c.Resize(16); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Resize on a closed cache = %v, want ErrClosed", err)
+	}
+}
+
+func TestResizeDuringWrites(t *testing.T) {
+	c := NewWithShards(2)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				c.Set(fmt.Sprint(w, "-", i), []byte("v"))
+			}
+		}(w)
+	}
+	for _, n := range []int{8, 32, 4} {
+		if err := c.Resize(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if c.Len() != 2000 {
+		t.Fatalf("Len = %d, want every write kept across resizes", c.Len())
+	}
+	for w := 0; w < 4; w++ {
+		for i := 0; i < 500; i++ {
+			if !c.Has(fmt.Sprint(w, "-", i)) {
+				t.Fatalf("key %d-%d lost across resizes", w, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package infux
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultRouterReplicas is the number of points each cache of a Router
+// takes on the hash ring when NewRouter is given zero.
+const DefaultRouterReplicas = 160
+
+// Router distributes keys across several independent caches with
+// consistent hashing, for example to give each NUMA node or size class
+// its own Cache while presenting a single cache to callers. Each cache is
+// placed on a hash ring at many points derived from its name, and a key
+// belongs to the cache owning the first point after the key's hash. Adding
+// or removing one of N caches thus moves only about 1/N of the keys, all
+// of them to or from the cache added or removed. Keys of a removed cache
+// are not migrated: they are simply missed by later lookups, like keys
+// evicted from a single cache. Likewise, keys moving to an added cache
+// leave their items in the caches they were in, which serve them again,
+// possibly stale, if that cache is removed later; give items a TTL where
+// that matters. A Router is safe for concurrent use.
+type Router struct {
+	mu       sync.RWMutex
+	replicas int
+	caches   map[string]*Cache
+	// ring holds the points of all caches, sorted by hash.
+	ring []routerPoint
+}
+
+// routerPoint is a point of a cache on a Router's hash ring.
+type routerPoint struct {
+	hash  uint64
+	cache *Cache
+}
+
+// NewRouter returns a Router without caches that places each cache at
+// replicas points of its ring, or DefaultRouterReplicas if replicas is
+// zero or negative. More points spread keys more evenly, at the cost of
+// memory and lookup time logarithmic in their number.
+func NewRouter(replicas int) *Router {
+	if replicas <= 0 {
+		replicas = DefaultRouterReplicas
+	}
+	return &Router{replicas: replicas, caches: make(map[string]*Cache)}
+}
+
+// Add adds cache to the router under name, replacing any cache already
+// added under that name. The name alone determines which keys the cache
+// receives, so a cache added again under the same name, even after a
+// restart, receives the same keys.
+func (r *Router) Add(name string, cache *Cache) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.caches[name] = cache
+	r.rebuild()
+}
+
+// Remove removes the cache added under name, if any, and returns it, so
+// that the caller may close it.
+func (r *Router) Remove(name string) *Cache {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cache := r.caches[name]
+	if cache != nil {
+		delete(r.caches, name)
+		r.rebuild()
+	}
+	return cache
+}
+
+// rebuild recomputes the ring from the caches. The caller must hold the
+// write lock.
+func (r *Router) rebuild() {
+	ring := make([]routerPoint, 0, len(r.caches)*r.replicas)
+	for name, cache := range r.caches {
+		for i := 0; i < r.replicas; i++ {
+			ring = append(ring, routerPoint{hash: bloomHash(name + "#" + strconv.Itoa(i)), cache: cache})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	r.ring = ring
+}
+
+// CacheFor returns the cache key belongs to, or nil if the router has no
+// caches.
+func (r *Router) CacheFor(key string) *Cache {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.ring) == 0 {
+		return nil
+	}
+	h := bloomHash(key)
+	i := sort.Search(len(r.ring), func(i int) bool { return r.ring[i].hash >= h })
+	if i == len(r.ring) {
+		// Past the last point, the ring wraps around to the first.
+		i = 0
+	}
+	return r.ring[i].cache
+}
+
+// Get retrieves an item from the cache key belongs to. It reports a miss
+// if the router has no caches.
+func (r *Router) Get(key string) ([]byte, bool) {
+	cache := r.CacheFor(key)
+	if cache == nil {
+		return nil, false
+	}
+	return cache.Get(key)
+}
+
+// Set adds an item to the cache key belongs to, replacing any existing
+// item. It is a no-op if the router has no caches.
+func (r *Router) Set(key string, value []byte) {
+	if cache := r.CacheFor(key); cache != nil {
+		cache.Set(key, value)
+	}
+}
+
+// SetWithTTL is like Set, but the item expires after ttl.
+func (r *Router) SetWithTTL(key string, value []byte, ttl time.Duration) {
+	if cache := r.CacheFor(key); cache != nil {
+		cache.SetWithTTL(key, value, ttl)
+	}
+}
+
+// Delete removes an item from the cache key belongs to.
+func (r *Router) Delete(key string) {
+	if cache := r.CacheFor(key); cache != nil {
+		cache.Delete(key)
+	}
+}
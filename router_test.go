@@ -0,0 +1,89 @@
+package infux
+
+import (
+	"fmt"
+	"testing"
+)
+
+// routes returns the cache of r each of n keys belongs to.
+func routes(r *Router, n int) []*Cache {
+	caches := make([]*Cache, n)
+	for i := range caches {
+		caches[i] = r.CacheFor(fmt.Sprint("key-", i))
+	}
+	return caches
+}
+
+func TestRouterKeyStability(t *testing.T) {
+	const keys = 10000
+	r := NewRouter(0)
+	if r.CacheFor("k") != nil {
+		t.Fatal("CacheFor returned a cache on an empty router")
+	}
+	first := New()
+	r.Add("cache-0", first)
+	for i := 1; i < 4; i++ {
+		r.Add(fmt.Sprint("cache-", i), New())
+	}
+	before := routes(r, keys)
+
+	added := New()
+	r.Add("cache-4", added)
+	after := routes(r, keys)
+	var moved int
+	for i := range before {
+		if after[i] != before[i] {
+			if after[i] != added {
+				t.Fatalf("key %d moved between caches that stayed", i)
+			}
+			moved++
+		}
+	}
+	// About 1/5 of the keys should move to the new cache.
+	if moved < keys/10 || moved > keys*3/10 {
+		t.Fatalf("adding a fifth cache moved %d of %d keys, want about %d", moved, keys, keys/5)
+	}
+
+	removed := r.Remove("cache-0")
+	if removed != first {
+		t.Fatal("Remove did not return the removed cache")
+	}
+	final := routes(r, keys)
+	for i := range after {
+		if after[i] != removed && final[i] != after[i] {
+			t.Fatalf("key %d moved off a cache that stayed", i)
+		}
+		if final[i] == removed {
+			t.Fatalf("key %d still routed to the removed cache", i)
+		}
+	}
+	r.Add("cache-0", removed)
+	for i, c := range routes(r, keys) {
+		if c != after[i] {
+			t.Fatalf("key %d routed differently once the cache was added back", i)
+		}
+	}
+}
+
+func TestRouterServesKeysFromTheirCache(t *testing.T) {
+	r := NewRouter(0)
+	for i := 0; i < 3; i++ {
+		r.Add(fmt.Sprint("cache-", i), New())
+	}
+	for i := 0; i < 100; i++ {
+		r.Set(fmt.Sprint(i), []byte(fmt.Sprint(i)))
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint(i)
+		if v, found := r.CacheFor(key).Get(key); !found || string(v) != key {
+			t.Fatalf("key %q not stored in the cache it routes to", key)
+		}
+		if v, _ := r.Get(key); string(v) != key {
+			t.Fatalf("Get(%q) = %q", key, v)
+		}
+	}
+	r.Delete("0")
+	if _, found := r.Get("0"); found {
+		t.Fatal("Get found a deleted key")
+	}
+}
@@ -0,0 +1,49 @@
+package infux
+
+import "runtime"
+
+const (
+	// shardsPerWriter is the number of shards RecommendShardCount gives
+	// each concurrent goroutine. With k goroutines spread at random over
+	// n shards, the chance that a given one finds its shard busy is about
+	// k/n, so 16 shards per goroutine keeps it near 6%.
+	shardsPerWriter = 16
+	// minEntriesPerShard is the number of items each shard should hold,
+	// at least, for its fixed overhead of a few hundred bytes (map header,
+	// LRU list, counters and lock, each on its own cache lines) to be
+	// small next to the items themselves.
+	minEntriesPerShard = 64
+	// maxRecommendedShards caps the recommendation, beyond which the
+	// shard table itself costs more than contention.
+	maxRecommendedShards = 1 << 16
+)
+
+// RecommendShardCount suggests a shard count, to pass to NewWithShards or
+// Config.Shards, for a cache used by concurrency goroutines at once and
+// expected to hold expectedEntries items. It trades lock contention,
+// which more shards reduce, against the per-shard overhead in memory and
+// in operations that visit every shard, such as Len, Stats and
+// DeleteExpired, which more shards increase. The heuristic gives each
+// goroutine 16 shards, but no more shards than leave 64 items to each,
+// and never fewer shards than goroutines, rounded up to a power of two
+// and capped at 65536. A concurrency of zero or less means GOMAXPROCS,
+// and an expectedEntries of zero or less leaves the size out of account.
+// For example, 8 goroutines and a million items give 128 shards, and 64
+// goroutines and a thousand items give 64. The result is only a starting
+// point: measure with the real workload, and adjust a live cache with
+// Resize if its size turns out different.
+func RecommendShardCount(concurrency int, expectedEntries int) int {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	n := min(concurrency, maxRecommendedShards) * shardsPerWriter
+	if expectedEntries > 0 {
+		n = min(n, expectedEntries/minEntriesPerShard)
+	}
+	n = min(max(n, concurrency, 1), maxRecommendedShards)
+	shards := 1
+	for shards < n {
+		shards *= 2
+	}
+	return shards
+}
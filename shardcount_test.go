@@ -0,0 +1,29 @@
+package infux
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestRecommendShardCount(t *testing.T) {
+	for _, tc := range []struct {
+		concurrency, entries, want int
+	}{
+		{8, 1000000, 128},
+		{64, 1000, 64},
+		{3, 500, 8},
+		{100, 100000000, 2048},
+		{1, 0, 16},
+		{1, 10, 1},
+		{1 << 20, 0, 1 << 16},
+		{runtime.GOMAXPROCS(0), 0, RecommendShardCount(0, 0)},
+	} {
+		got := RecommendShardCount(tc.concurrency, tc.entries)
+		if got != tc.want {
+			t.Errorf("RecommendShardCount(%d, %d) = %d, want %d", tc.concurrency, tc.entries, got, tc.want)
+		}
+		if !isPowerOfTwo(got) {
+			t.Errorf("RecommendShardCount(%d, %d) = %d, not a power of two", tc.concurrency, tc.entries, got)
+		}
+	}
+}
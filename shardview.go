@@ -0,0 +1,125 @@
+package infux
+
+import "time"
+
+// ShardView gives access to the items of a single shard while WithShard
+// or LockKey holds the shard's lock, so many keys of that shard can be
+// read and written with one lock acquisition. A ShardView is only valid
+// while the lock is held, and its methods panic once it is released.
+// Every method panics if given a key that belongs to another shard; use
+// Owns to check.
+type ShardView struct {
+	v *shardView
+}
+
+// shardView is the state behind a ShardView.
+type shardView struct {
+	c      *Cache
+	shard  *cacheShard
+	active bool
+}
+
+// WithShard locks the shard that key belongs to and calls fn with a view
+// of it, for example to import a batch of keys known to share the shard
+// with a single lock acquisition. The shard stays write-locked while fn
+// runs, so fn must not use the cache other than through the view, and
+// should return quickly. Cache-wide limits are enforced as usual, with
+// evictions from other shards deferred until fn returns. WithShard does
+// not call fn on a closed cache.
+func (c *Cache) WithShard(key string, fn func(s ShardView)) {
+	if c.closed.Load() {
+		return
+	}
+	s, unlock := c.LockKey(key)
+	defer unlock()
+	fn(s)
+}
+
+// LockKey write-locks the shard that key belongs to and returns a view of
+// it along with the function that releases the lock, for sequences the
+// other methods do not cover, such as updating the cache and some external
+// state under a single lock. Until unlock is called, the key's shard, and
+// every other key that happens to share it, is blocked for all other
+// goroutines, so the caller should release it quickly, typically with
+// defer, and must not block on anything that could itself wait for the
+// shard. While holding the lock, read and write the shard's keys only
+// through the view; calling Get, Set or any other method of the cache
+// itself on a key of the locked shard locks it again and deadlocks, as
+// does calling LockKey twice for such keys, and locking the shards of two
+// keys from several goroutines may deadlock if they lock them in
+// different orders. Cache-wide limits are enforced as usual, with
+// evictions from other shards deferred until unlock is called, and writes
+// through the view are ignored on a closed or frozen cache. Calling unlock
+// again has no effect.
+func (c *Cache) LockKey(key string) (s ShardView, unlock func()) {
+	key = c.normalize(key)
+	v := &shardView{c: c, shard: c.lockShard(key), active: true}
+	return ShardView{v: v}, func() {
+		if !v.active {
+			return
+		}
+		v.active = false
+		c.unlock(v.shard)
+		c.evictOverflow(v.shard)
+	}
+}
+
+// Owns reports whether key belongs to the view's shard.
+func (s ShardView) Owns(key string) bool {
+	return s.v.c.getShard(s.v.c.normalize(key)) == s.v.shard
+}
+
+// check panics if the view is no longer valid or key is not in its shard,
+// and returns the normalized key.
+func (s ShardView) check(key string) string {
+	if !s.v.active {
+		panic("infux: ShardView used after its shard was unlocked")
+	}
+	key = s.v.c.normalize(key)
+	if s.v.c.getShard(key) != s.v.shard {
+		panic("infux: ShardView used with a key of another shard")
+	}
+	return key
+}
+
+// Get retrieves an item from the shard, like Cache.Get without the
+// Loader.
+func (s ShardView) Get(key string) ([]byte, bool) {
+	key = s.check(key)
+	e, found := s.v.c.lookupLocked(s.v.shard, key, true)
+	if !found {
+		return nil, false
+	}
+	return s.v.c.valueOut(e), true
+}
+
+// Set adds an item to the shard, replacing any existing item, like
+// Cache.Set.
+func (s ShardView) Set(key string, value []byte) {
+	key = s.check(key)
+	if s.v.c.writeErr() != nil {
+		return
+	}
+	s.v.c.insertLocked(s.v.shard, s.v.c.newEntry(key, value))
+}
+
+// SetWithTTL adds an item to the shard that expires after ttl, like
+// Cache.SetWithTTL.
+func (s ShardView) SetWithTTL(key string, value []byte, ttl time.Duration) {
+	key = s.check(key)
+	if s.v.c.writeErr() != nil {
+		return
+	}
+	s.v.c.insertLocked(s.v.shard, s.v.c.newTTLEntry(key, value, ttl))
+}
+
+// Delete removes an item from the shard, like Cache.Delete.
+func (s ShardView) Delete(key string) {
+	key = s.check(key)
+	if s.v.c.writeErr() != nil {
+		return
+	}
+	if e, found := s.v.shard.items[key]; found {
+		s.v.c.deleteLocked(s.v.shard, e)
+	}
+}
@@ -0,0 +1,251 @@
+package infux
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Snapshot format
+//
+// A snapshot starts with a header made of the magic bytes "INFX" and a
+// version byte. It is followed by a sequence of records, each introduced
+// by a record type byte:
+//
+//	recordEntry: uvarint key length, key bytes,
+//	             uvarint value length, value bytes,
+//	             varint expiry in Unix nanoseconds (0 for none)
+//	recordEnd:   marks the end of the snapshot
+//
+// The explicit end record lets Restore tell a complete snapshot from a
+// truncated one.
+
+const (
+	snapshotMagic   = "INFX"
+	snapshotVersion = 1
+
+	recordEnd   = 0
+	recordEntry = 1
+)
+
+// ErrInvalidSnapshot is returned by Restore when the input is not a valid
+// snapshot, or was written by an unsupported version of the format.
+var ErrInvalidSnapshot = errors.New("infux: invalid snapshot")
+
+// snapshotRecord is a single item copied out of a shard for writing.
+type snapshotRecord struct {
+	key       string
+	value     []byte
+	expiresAt int64
+}
+
+// Snapshot writes all live items in the cache, including their expiry
+// times, to w. Items are copied out of one shard at a time and written
+// after that shard's lock is released, so a slow writer never blocks
+// cache operations, and memory use is bounded by the size of a single
+// shard. Like ForEach, the snapshot is consistent per shard but not
+// across the whole cache. Items written with SetWithMaxIdle are saved
+// with the time their idle time runs out as their expiry time.
+func (c *Cache) Snapshot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	if err := bw.WriteByte(snapshotVersion); err != nil {
+		return err
+	}
+	var records []snapshotRecord
+	var buf [binary.MaxVarintLen64]byte
+	for _, shard := range c.table().shards {
+		records = c.copyShard(shard, records[:0])
+		for _, rec := range records {
+			bw.WriteByte(recordEntry)
+			bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(rec.key)))])
+			bw.WriteString(rec.key)
+			bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(rec.value)))])
+			bw.Write(rec.value)
+			if _, err := bw.Write(buf[:binary.PutVarint(buf[:], rec.expiresAt)]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := bw.WriteByte(recordEnd); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// CloseAndSnapshot shuts the cache down cleanly for a restart, writing
+// its final contents to w. The steps happen in an order that makes the
+// snapshot the last state of the cache: it freezes the cache, so that no
+// further writes are accepted, then brings the Config.Persist file up to
+// date, if any, then writes the snapshot, and only then closes the cache,
+// stopping its background goroutines. As with Freeze, writes already
+// under way when it is called may still complete, and land in the
+// snapshot or not; callers should stop writing first. The cache is closed
+// even if the snapshot fails, and is unusable afterwards, as after Close.
+// CloseAndSnapshot returns the error of the snapshot, if any, and
+// ErrClosed, writing nothing, on a closed cache.
+func (c *Cache) CloseAndSnapshot(w io.Writer) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	c.Freeze()
+	if c.persist != nil {
+		c.flushPersisted()
+	}
+	err := c.Snapshot(w)
+	if cerr := c.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// copyShard appends the live items of shard to records.
+func (c *Cache) copyShard(shard *cacheShard, records []snapshotRecord) []snapshotRecord {
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	now := c.now()
+	for key, e := range shard.items {
+		if !e.expired(now) {
+			records = append(records, snapshotRecord{key: key, value: c.valueOf(e.pinned()), expiresAt: e.deadline()})
+		}
+	}
+	return records
+}
+
+// Restore reads a snapshot written by Snapshot from r and adds its items
+// to the cache, keeping their original expiry times. Items that have
+// expired since the snapshot was taken are skipped. Restoring into a
+// non-empty cache merges the snapshot into it, overwriting existing items
+// with the same key. If Restore returns an error, the items read before
+// the error remain in the cache.
+func (c *Cache) Restore(r io.Reader) error {
+	if err := c.writeErr(); err != nil {
+		return err
+	}
+	br := bufio.NewReader(r)
+	var header [len(snapshotMagic) + 1]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return snapshotError(err)
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return ErrInvalidSnapshot
+	}
+	if header[len(snapshotMagic)] != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, header[len(snapshotMagic)])
+	}
+	for {
+		kind, err := br.ReadByte()
+		if err != nil {
+			return snapshotError(err)
+		}
+		switch kind {
+		case recordEnd:
+			return nil
+		case recordEntry:
+		default:
+			return fmt.Errorf("%w: unknown record type %d", ErrInvalidSnapshot, kind)
+		}
+		key, err := readSnapshotBytes(br)
+		if err != nil {
+			return err
+		}
+		value, err := readSnapshotBytes(br)
+		if err != nil {
+			return err
+		}
+		expiresAt, err := binary.ReadVarint(br)
+		if err != nil {
+			return snapshotError(err)
+		}
+		if expiresAt != 0 && expiresAt <= c.now() {
+			continue
+		}
+		c.set(c.encode(&entry{key: string(key), value: value, expiresAt: expiresAt}))
+	}
+}
+
+// readSnapshotBytes reads a uvarint length followed by that many bytes.
+func readSnapshotBytes(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, snapshotError(err)
+	}
+	return readSnapshotN(br, n)
+}
+
+// readSnapshotN reads n bytes. Large lengths are read incrementally, so a
+// corrupt length cannot force a huge allocation before the data runs out.
+func readSnapshotN(br *bufio.Reader, n uint64) ([]byte, error) {
+	const smallRead = 64 << 10
+	if n <= smallRead {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, snapshotError(err)
+		}
+		return b, nil
+	}
+	var buf bytes.Buffer
+	if m, err := io.CopyN(&buf, br, int64(n)); err != nil || uint64(m) != n {
+		return nil, snapshotError(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// snapshotError converts an error from reading a snapshot, treating a
+// premature end of input as a truncated snapshot.
+func snapshotError(err error) error {
+	if err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: unexpected end of input", ErrInvalidSnapshot)
+	}
+	return err
+}
+
+// WriteTo implements io.WriterTo by writing a snapshot of the cache to w,
+// as Snapshot does. It returns the number of bytes written to w, which
+// on error includes everything written before the error.
+func (c *Cache) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := c.Snapshot(cw)
+	return cw.n, err
+}
+
+// ReadFrom implements io.ReaderFrom by reading a snapshot from r and
+// adding its items to the cache, as Restore does. Input is buffered, so r
+// may deliver the snapshot in reads of any size, as network connections
+// do. It returns the number of bytes read from r, which includes any
+// input buffered past the end of the snapshot. Reading stops at the end
+// of the snapshot, so r need not reach EOF.
+func (c *Cache) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	err := c.Restore(cr)
+	return cr.n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,41 @@
+package infux
+
+import "sync"
+
+// lockSpins is the number of times a shardMutex with spinning tries to
+// acquire a held lock before blocking.
+const lockSpins = 32
+
+// shardMutex is the lock of a shard: a sync.RWMutex that, with
+// Config.SpinBeforeBlock, first retries a held lock a bounded number of
+// times, betting that critical sections as short as a map lookup end
+// before parking and waking a goroutine would.
+type shardMutex struct {
+	sync.RWMutex
+	// spin is set before the shard is shared and never changed.
+	spin bool
+}
+
+// Lock write-locks m.
+func (m *shardMutex) Lock() {
+	if m.spin {
+		for i := 0; i < lockSpins; i++ {
+			if m.TryLock() {
+				return
+			}
+		}
+	}
+	m.RWMutex.Lock()
+}
+
+// RLock read-locks m.
+func (m *shardMutex) RLock() {
+	if m.spin {
+		for i := 0; i < lockSpins; i++ {
+			if m.TryRLock() {
+				return
+			}
+		}
+	}
+	m.RWMutex.RLock()
+}
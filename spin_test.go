@@ -0,0 +1,62 @@
+package infux
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestShardMutexSpinningExcludes(t *testing.T) {
+	m := &shardMutex{spin: true}
+	var wg sync.WaitGroup
+	var n int
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Lock()
+				n++
+				m.Unlock()
+				m.RLock()
+				_ = n
+				m.RUnlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if n != 8000 {
+		t.Fatalf("n = %d, want 8000", n)
+	}
+}
+
+// BenchmarkContendedGet measures parallel reads and writes of a few hot
+// keys of an LRU cache, whose lookups take the shard's write lock, with
+// plain and spinning shard locks, and with more shards instead.
+func BenchmarkContendedGet(b *testing.B) {
+	for _, cfg := range []Config{
+		{Shards: 4},
+		{Shards: 4, SpinBeforeBlock: true},
+		{Shards: 256},
+	} {
+		cfg.MaxEntries = 1 << 16
+		b.Run(fmt.Sprintf("Shards=%d/SpinBeforeBlock=%v", cfg.Shards, cfg.SpinBeforeBlock), func(b *testing.B) {
+			c := NewWithConfig(cfg)
+			keys := make([]string, 64)
+			for i := range keys {
+				keys[i] = fmt.Sprint(i)
+				c.Set(keys[i], []byte("v"))
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if i%16 == 0 {
+						c.Set(keys[i%len(keys)], []byte("v"))
+					} else {
+						c.Get(keys[i%len(keys)])
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package infux
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a point-in-time snapshot of cache operation counters.
+type Stats struct {
+	// Hits is the number of lookups that found a live item.
+	Hits uint64
+	// Misses is the number of lookups that found no item or an
+	// expired one.
+	Misses uint64
+	// Sets is the number of items written.
+	Sets uint64
+	// Deletes is the number of items removed by Delete.
+	Deletes uint64
+	// Evictions is the number of items removed to keep the cache within
+	// its limits.
+	Evictions uint64
+	// Expirations is the number of expired items removed, by the sweeper,
+	// DeleteExpired, Get, Has, or a write over the expired item. Explicit
+	// deletes are not counted.
+	Expirations uint64
+
+	// AvgValueBytes is the average length of the values in the cache,
+	// including expired items not removed yet, or 0 if it is empty.
+	AvgValueBytes float64
+	// MaxValueBytes is the length of the largest value stored since the
+	// cache was created or last cleared. It is a high-water mark, not the
+	// largest value stored now: it does not go down when that value is
+	// deleted.
+	//
+	// Both value sizes describe the whole cache and are only set by
+	// Cache.Stats, and lengths are those of the stored, possibly
+	// compressed, values.
+	MaxValueBytes int64
+
+	// Breaker is the state of the Loader's circuit breaker, and
+	// BreakerRejections the number of loads it failed fast since the
+	// cache was created. They are only set by Cache.Stats, with
+	// Config.LoaderBreakerThreshold.
+	Breaker           BreakerState
+	BreakerRejections uint64
+
+	// AdmissionRejections is the number of writes of new items dropped by
+	// TinyLFU admission since the cache was created. It is only set by
+	// Cache.Stats.
+	AdmissionRejections uint64
+}
+
+// HitRatio returns the fraction of lookups that were hits, or 0 if no
+// lookups have been made.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// shardStats holds the operation counters for a single shard. Keeping
+// the counters per shard avoids a single hot cache line shared by every
+// goroutine using the cache.
+type shardStats struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	sets        atomic.Uint64
+	deletes     atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// Stats returns a snapshot of the cache's operation counters, summed
+// across all shards, and of its value sizes. The counters of different
+// shards are read one after another, so the snapshot may not reflect a
+// single instant. It takes no locks and runs in time proportional to the
+// number of shards.
+func (c *Cache) Stats() Stats {
+	s := c.retired.snapshot()
+	for _, shard := range c.table().shards {
+		s.add(shard.stats.snapshot())
+	}
+	if n := c.Len(); n > 0 {
+		s.AvgValueBytes = float64(c.valueSize.Load()) / float64(n)
+	}
+	s.MaxValueBytes = c.maxValue.Load()
+	if c.breaker != nil {
+		s.Breaker, s.BreakerRejections = c.breaker.snapshot(c.now())
+	}
+	if c.sketch != nil {
+		s.AdmissionRejections = c.sketch.rejections.Load()
+	}
+	return s
+}
+
+// add adds the counters of other to s.
+func (s *Stats) add(other Stats) {
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+	s.Sets += other.Sets
+	s.Deletes += other.Deletes
+	s.Evictions += other.Evictions
+	s.Expirations += other.Expirations
+}
+
+// snapshot returns the current values of the counters.
+func (s *shardStats) snapshot() Stats {
+	return Stats{
+		Hits:        s.hits.Load(),
+		Misses:      s.misses.Load(),
+		Sets:        s.sets.Load(),
+		Deletes:     s.deletes.Load(),
+		Evictions:   s.evictions.Load(),
+		Expirations: s.expirations.Load(),
+	}
+}
+
+// add adds the counters of other to s.
+func (s *shardStats) add(other Stats) {
+	s.hits.Add(other.Hits)
+	s.misses.Add(other.Misses)
+	s.sets.Add(other.Sets)
+	s.deletes.Add(other.Deletes)
+	s.evictions.Add(other.Evictions)
+	s.expirations.Add(other.Expirations)
+}
+
+// reset sets the counters back to zero.
+func (s *shardStats) reset() {
+	s.hits.Store(0)
+	s.misses.Store(0)
+	s.sets.Store(0)
+	s.deletes.Store(0)
+	s.evictions.Store(0)
+	s.expirations.Store(0)
+}
+
+// ResetStats sets all operation counters back to zero, so that Stats
+// reports only operations made afterwards.
+func (c *Cache) ResetStats() {
+	c.retired.reset()
+	for _, shard := range c.table().shards {
+		shard.stats.reset()
+	}
+}
+
+// ShardStat describes the contents and operation counters of one shard.
+type ShardStat struct {
+	// Index is the position of the shard, from 0 to the shard count - 1.
+	Index int
+	// Items is the number of items in the shard, including expired items
+	// that have not been removed yet.
+	Items int
+	// Bytes is the total length of the shard's keys and values.
+	Bytes int64
+	// Stats holds the shard's share of the cache's operation counters.
+	Stats
+}
+
+// ShardStats returns one ShardStat per shard, in shard order. Comparing
+// the item counts and hit rates of the shards reveals a skewed key
+// distribution, which concentrates lock contention on a few shards and
+// may call for a different hash function. Each shard is read-locked only
+// briefly, one after another.
+func (c *Cache) ShardStats() []ShardStat {
+	shards := c.table().shards
+	stats := make([]ShardStat, len(shards))
+	for i, shard := range shards {
+		shard.mu.RLock()
+		stats[i] = ShardStat{Index: i, Items: len(shard.items), Bytes: shard.size}
+		shard.mu.RUnlock()
+		stats[i].Stats = shard.stats.snapshot()
+	}
+	return stats
+}
+
+// DistReport summarizes how evenly items are spread across the shards of
+// a cache. See DistributionReport.
+type DistReport struct {
+	// Shards is the number of shards.
+	Shards int
+	// Min, Max and Mean are the smallest, largest and average number of
+	// items in a shard, and StdDev is the population standard deviation
+	// of the per-shard item counts.
+	Min, Max int
+	Mean     float64
+	StdDev   float64
+	// ChiSquare is Pearson's chi-squared statistic of the per-shard item
+	// counts against a uniform spread. For keys hashed uniformly at
+	// random it is close to Shards-1; values several times larger point
+	// to a skewed distribution. It is 0 for an empty cache.
+	ChiSquare float64
+}
+
+// DistributionReport returns statistics of the number of items per shard,
+// to check whether keys are spread evenly, or whether a custom HashFunc
+// or the key format causes skew. It is built from ShardStats, and is a
+// diagnostic tool rather than something to call on a hot path.
+func (c *Cache) DistributionReport() DistReport {
+	shards := c.ShardStats()
+	r := DistReport{Shards: len(shards), Min: shards[0].Items}
+	total := 0
+	for _, s := range shards {
+		total += s.Items
+		r.Min = min(r.Min, s.Items)
+		r.Max = max(r.Max, s.Items)
+	}
+	r.Mean = float64(total) / float64(len(shards))
+	var squares float64
+	for _, s := range shards {
+		d := float64(s.Items) - r.Mean
+		squares += d * d
+	}
+	r.StdDev = math.Sqrt(squares / float64(len(shards)))
+	if total > 0 {
+		r.ChiSquare = squares / r.Mean
+	}
+	return r
+}
+
+// BucketCount is a bucket of the histogram returned by AgeHistogram.
+type BucketCount struct {
+	// Min and Max bound the durations counted in the bucket, from Min
+	// included to Max excluded. The last bucket has no upper bound, and
+	// its Max is 0.
+	Min, Max time.Duration
+	// Expiring is the number of items with a TTL whose remaining time to
+	// live falls in the bucket.
+	Expiring int
+	// Permanent is the number of items without a TTL whose age, the time
+	// since they were last written, falls in the bucket.
+	Permanent int
+}
+
+// DefaultAgeBuckets are the bucket bounds AgeHistogram uses when called
+// without any.
+var DefaultAgeBuckets = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute}
+
+// AgeHistogram returns a histogram of the live items, counting items with
+// a TTL by how long until they expire and items without one by how long
+// ago they were written, to help tune expiration policies. bounds are the
+// increasing upper bounds of the buckets but the last, which collects
+// everything longer; without bounds, DefaultAgeBuckets are used, which
+// gives the buckets under 1 minute, 1 to 5 minutes, 5 to 30 minutes and
+// over 30 minutes. It scans every item one shard at a time, so it is a
+// diagnostic tool rather than something to call on a hot path.
+func (c *Cache) AgeHistogram(bounds ...time.Duration) []BucketCount {
+	if len(bounds) == 0 {
+		bounds = DefaultAgeBuckets
+	}
+	buckets := make([]BucketCount, len(bounds)+1)
+	for i, bound := range bounds {
+		buckets[i].Max = bound
+		buckets[i+1].Min = bound
+	}
+	for _, shard := range c.table().shards {
+		shard.mu.RLock()
+		now := c.now()
+		for _, e := range shard.items {
+			if e.expired(now) {
+				continue
+			}
+			if at := e.deadline(); at != 0 {
+				buckets[ageBucket(bounds, time.Duration(at-now))].Expiring++
+			} else {
+				buckets[ageBucket(bounds, time.Duration(now-e.writtenAt))].Permanent++
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return buckets
+}
+
+// ageBucket returns the index of the bucket that d falls in.
+func ageBucket(bounds []time.Duration, d time.Duration) int {
+	i := 0
+	for i < len(bounds) && d >= bounds[i] {
+		i++
+	}
+	return i
+}
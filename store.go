@@ -0,0 +1,48 @@
+package infux
+
+import "time"
+
+// Getter is implemented by caches that look items up by key.
+type Getter interface {
+	Get(key string) ([]byte, bool)
+}
+
+// Setter is implemented by caches that store items by key.
+type Setter interface {
+	Set(key string, value []byte)
+	SetWithTTL(key string, value []byte, ttl time.Duration)
+}
+
+// Deleter is implemented by caches that remove items by key.
+type Deleter interface {
+	Delete(key string)
+}
+
+// Store is the core surface of a Cache, for code that would rather depend
+// on an interface than on *Cache, for example to inject a fake in tests.
+// Code needing less should depend on the smaller Getter, Setter or
+// Deleter, which Tiered and Router also implement. Store covers the
+// common operations only, and may grow as further methods become part of
+// the stable surface; fakes that embed a Store, or a *Cache, keep
+// compiling when it does.
+type Store interface {
+	Getter
+	Setter
+	Deleter
+	Has(key string) bool
+	Len() int
+	Clear()
+	Close() error
+}
+
+var (
+	_ Store = (*Cache)(nil)
+
+	_ Getter  = (*Tiered)(nil)
+	_ Setter  = (*Tiered)(nil)
+	_ Deleter = (*Tiered)(nil)
+
+	_ Getter  = (*Router)(nil)
+	_ Setter  = (*Router)(nil)
+	_ Deleter = (*Router)(nil)
+)
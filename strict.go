@@ -0,0 +1,119 @@
+package infux
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrInvalidKey is returned by StrictCache writes given an empty key or a
+// key longer than StrictLimits.MaxKeyLength.
+var ErrInvalidKey = errors.New("infux: invalid key")
+
+// StrictLimits are the limits a StrictCache enforces on writes. Zero
+// fields take their value from DefaultStrictLimits.
+type StrictLimits struct {
+	// MaxKeyLength is the longest key accepted, in bytes.
+	MaxKeyLength int
+	// MaxValueLength is the longest value accepted, in bytes.
+	MaxValueLength int
+}
+
+// DefaultStrictLimits are the limits used by a StrictCache for the fields
+// of its StrictLimits that are zero. They match memcached's defaults.
+var DefaultStrictLimits = StrictLimits{
+	MaxKeyLength:   250,
+	MaxValueLength: 1 << 20,
+}
+
+// StrictCache is a view of a Cache that validates writes, for example so
+// that a buggy tenant of a shared cache cannot store huge keys that bloat
+// its maps. Writes of an empty key or one longer than the key limit fail
+// with ErrInvalidKey, and writes of a value longer than the value limit
+// fail with ErrTooLarge, leaving the cache unchanged. Keys are checked
+// as normalized by Config.KeyNormalizer. Reads and deletes are not
+// validated. A StrictCache shares the cache's items, limits and
+// statistics, and is safe for concurrent use; the Cache itself stays as
+// permissive as ever.
+type StrictCache struct {
+	cache  *Cache
+	limits StrictLimits
+}
+
+// Strict returns a StrictCache view of the cache enforcing limits.
+func (c *Cache) Strict(limits StrictLimits) *StrictCache {
+	if limits.MaxKeyLength <= 0 {
+		limits.MaxKeyLength = DefaultStrictLimits.MaxKeyLength
+	}
+	if limits.MaxValueLength <= 0 {
+		limits.MaxValueLength = DefaultStrictLimits.MaxValueLength
+	}
+	return &StrictCache{cache: c, limits: limits}
+}
+
+// Limits returns the limits the view enforces.
+func (s *StrictCache) Limits() StrictLimits {
+	return s.limits
+}
+
+// check validates a write of value under key, a normalized key.
+func (s *StrictCache) check(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	if len(key) > s.limits.MaxKeyLength {
+		return fmt.Errorf("%w: key of %d bytes exceeds the limit of %d", ErrInvalidKey, len(key), s.limits.MaxKeyLength)
+	}
+	if len(value) > s.limits.MaxValueLength {
+		return fmt.Errorf("%w: value of %d bytes exceeds the limit of %d", ErrTooLarge, len(value), s.limits.MaxValueLength)
+	}
+	return nil
+}
+
+// Set validates key and value and stores them like Cache.TrySet,
+// returning the error that rejected the write, if any.
+func (s *StrictCache) Set(key string, value []byte) error {
+	return s.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL is like Set, but the stored item expires after ttl. A zero
+// or negative ttl means the item never expires.
+func (s *StrictCache) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	key = s.cache.normalize(key)
+	if err := s.check(key, value); err != nil {
+		return err
+	}
+	return s.cache.setWithTTL(key, value, ttl)
+}
+
+// SetMultiChecked validates every item, in sorted order of normalized
+// keys, and returns the error rejecting the first offender, annotated
+// with its key, before writing anything. Once all of them pass, it stores
+// them like Cache.SetMultiChecked, which also checks them against the
+// cache's own limits; only the validation is atomic, not the writes to
+// the shards.
+func (s *StrictCache) SetMultiChecked(items map[string][]byte) error {
+	items = s.cache.normalizeItems(items)
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := s.check(key, items[key]); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+	}
+	return s.cache.setMultiChecked(items)
+}
+
+// Get retrieves an item from the cache, like Cache.Get.
+func (s *StrictCache) Get(key string) ([]byte, bool) {
+	return s.cache.Get(key)
+}
+
+// Delete removes an item from the cache, like Cache.Delete.
+func (s *StrictCache) Delete(key string) {
+	s.cache.Delete(key)
+}
@@ -0,0 +1,61 @@
+package infux
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStrictCacheNormalizesKeys(t *testing.T) {
+	c := NewWithConfig(Config{KeyNormalizer: strings.ToLower})
+	s := c.Strict(StrictLimits{})
+	if err := s.Set("Foo", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := s.Get("Foo"); !found {
+		t.Fatal("Get of the key written through the view missed")
+	}
+	if keys := c.Keys(); len(keys) != 1 || keys[0] != "foo" {
+		t.Fatalf("Keys = %q, want [foo]", keys)
+	}
+}
+
+func TestStrictCacheRejects(t *testing.T) {
+	c := New()
+	s := c.Strict(StrictLimits{MaxKeyLength: 3, MaxValueLength: 4})
+	for _, tc := range []struct {
+		key   string
+		value string
+		err   error
+	}{
+		{"", "v", ErrInvalidKey},
+		{"long", "v", ErrInvalidKey},
+		{"k", "large", ErrTooLarge},
+		{"k", "fits", nil},
+	} {
+		if err := s.Set(tc.key, []byte(tc.value)); !errors.Is(err, tc.err) {
+			t.Errorf("Set(%q, %q) = %v, want %v", tc.key, tc.value, err, tc.err)
+		}
+	}
+	if c.Len() != 1 {
+		t.Fatalf("Len = %d after one valid write, want 1", c.Len())
+	}
+}
+
+func TestStrictCacheSetMultiCheckedNormalizesKeys(t *testing.T) {
+	c := NewWithConfig(Config{KeyNormalizer: strings.ToLower})
+	s := c.Strict(StrictLimits{MaxKeyLength: 3})
+	err := s.SetMultiChecked(map[string][]byte{"Ab": []byte("v"), "long": []byte("v")})
+	if !errors.Is(err, ErrInvalidKey) || !strings.Contains(err.Error(), `"long"`) {
+		t.Fatalf("SetMultiChecked = %v, want ErrInvalidKey naming \"long\"", err)
+	}
+	if c.Len() != 0 {
+		t.Fatal("a rejected batch was partly written")
+	}
+	if err := s.SetMultiChecked(map[string][]byte{"Ab": []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := c.Get("AB"); !found {
+		t.Fatal("item written by SetMultiChecked not found under its normalized key")
+	}
+}
@@ -0,0 +1,24 @@
+package infux
+
+// SetString is like Set for a string value. The conversion to []byte makes
+// the one copy of value the cache keeps, so unlike Set it never copies the
+// value a second time, whatever Config.CopyOnSet says.
+func (c *Cache) SetString(key, value string) {
+	key = c.normalize(key)
+	c.set(c.encode(&entry{key: key, value: []byte(value)}))
+}
+
+// GetString is like Get, but returns the value as a string. The conversion
+// copies the value, so the result never shares memory with the cache and
+// no further copy is made, whatever Config.CopyOnGet says.
+func (c *Cache) GetString(key string) (string, bool) {
+	key = c.normalize(key)
+	if e, found := c.lookup(key); found {
+		return string(c.valueOf(e)), true
+	}
+	if c.loader == nil {
+		return "", false
+	}
+	value, err := c.load(key)
+	return string(value), err == nil
+}
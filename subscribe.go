@@ -0,0 +1,108 @@
+package infux
+
+// EventType identifies the kind of change an Event reports.
+type EventType int
+
+const (
+	// EventSet means a value was written under the key.
+	EventSet EventType = iota + 1
+	// EventDelete means the key was explicitly deleted, by Delete or one
+	// of the other deleting methods.
+	EventDelete
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event reports a change to a key, delivered to its subscribers.
+type Event struct {
+	Type EventType
+	Key  string
+}
+
+// subscriberBuffer is the number of events buffered for each subscriber
+// before further events are dropped.
+const subscriberBuffer = 64
+
+// Subscribe returns a channel that receives an Event every time key is
+// written or explicitly deleted, for example to invalidate copies of the
+// value held elsewhere. Delivery is best effort and in-process only: the
+// event is sent while the write holds the shard lock, so it is never
+// waited for, and it is dropped if the subscriber has not yet received
+// the events buffered before it. Evictions, expirations and Clear are not
+// reported. The channel is closed by Unsubscribe or Close.
+func (c *Cache) Subscribe(key string) <-chan Event {
+	key = c.normalize(key)
+	ch := make(chan Event, subscriberBuffer)
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.closed.Load() {
+		close(ch)
+		return ch
+	}
+	if c.subs == nil {
+		c.subs = make(map[string][]chan Event)
+	}
+	c.subs[key] = append(c.subs[key], ch)
+	c.subscribers.Add(1)
+	return ch
+}
+
+// Unsubscribe stops the delivery of events on ch, a channel returned by
+// Subscribe for key, and closes it. It does nothing if ch is not
+// subscribed to key.
+func (c *Cache) Unsubscribe(key string, ch <-chan Event) {
+	key = c.normalize(key)
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	subs := c.subs[key]
+	for i, sub := range subs {
+		if sub != ch {
+			continue
+		}
+		close(sub)
+		c.subscribers.Add(-1)
+		if len(subs) == 1 {
+			delete(c.subs, key)
+		} else {
+			c.subs[key] = append(subs[:i:i], subs[i+1:]...)
+		}
+		return
+	}
+}
+
+// publish sends an event for key to its subscribers without blocking.
+func (c *Cache) publish(t EventType, key string) {
+	if c.subscribers.Load() == 0 {
+		return
+	}
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	for _, ch := range c.subs[key] {
+		select {
+		case ch <- Event{Type: t, Key: key}:
+		default:
+		}
+	}
+}
+
+// closeSubscriptions closes the channels of every subscriber.
+func (c *Cache) closeSubscriptions() {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	for _, subs := range c.subs {
+		for _, ch := range subs {
+			close(ch)
+		}
+	}
+	c.subs = nil
+	c.subscribers.Store(0)
+}
@@ -0,0 +1,99 @@
+package infux
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// tagIndex maps each tag to the keys of the items stored with it, for
+// InvalidateTag.
+type tagIndex struct {
+	mu   sync.Mutex
+	keys map[string]map[string]struct{}
+	// used is set once an item has been stored with tags, so that Clear
+	// only walks the items of caches that use tags.
+	used atomic.Bool
+}
+
+// SetWithTags adds an item to the cache like Set, and files it under
+// tags, so that InvalidateTag can delete all the items of a tag at once,
+// for example the items of one tenant whatever their keys. The tags
+// belong to the stored value: any later write to the key, including
+// Replace, Append and Increment, stores the new value without tags, and
+// Snapshot does not record tags. Once the item is deleted, evicted or
+// expired, it is removed from its tags.
+//
+// The tag index is kept beside the shards under a single lock taken by
+// every write and removal of a tagged item. It costs memory for each
+// distinct tag, plus a copy of the tags and an index entry per tag for
+// each tagged item.
+func (c *Cache) SetWithTags(key string, value []byte, tags ...string) {
+	key = c.normalize(key)
+	e := c.newEntry(key, value)
+	if len(tags) > 0 {
+		e.tags = slices.Clone(tags)
+	}
+	c.set(e)
+}
+
+// InvalidateTag deletes the items filed under tag by SetWithTags, and
+// returns the number of live items it deleted. Like DeleteMulti, it locks
+// each shard once, does not call OnEvict and does not count expired
+// items. Items tagged concurrently with InvalidateTag may be kept.
+// InvalidateTag returns 0 on a closed cache.
+func (c *Cache) InvalidateTag(tag string) int {
+	if c.writeErr() != nil {
+		return 0
+	}
+	c.tags.mu.Lock()
+	keys := make([]string, 0, len(c.tags.keys[tag]))
+	for key := range c.tags.keys[tag] {
+		keys = append(keys, key)
+	}
+	c.tags.mu.Unlock()
+	return c.deleteKeys(keys, func(e *entry) bool {
+		// The key may have been rewritten without the tag since.
+		return slices.Contains(e.tags, tag)
+	})
+}
+
+// tagLocked adds e, which is being stored in its shard, to the tag index
+// under its tags. The caller must hold the shard's write lock.
+func (c *Cache) tagLocked(e *entry) {
+	if len(e.tags) == 0 {
+		return
+	}
+	c.tags.used.Store(true)
+	c.tags.mu.Lock()
+	defer c.tags.mu.Unlock()
+	if c.tags.keys == nil {
+		c.tags.keys = make(map[string]map[string]struct{})
+	}
+	for _, tag := range e.tags {
+		keys := c.tags.keys[tag]
+		if keys == nil {
+			keys = make(map[string]struct{})
+			c.tags.keys[tag] = keys
+		}
+		keys[e.key] = struct{}{}
+	}
+}
+
+// untagLocked removes e, which is being removed from its shard, from the
+// tag index. The caller must hold the shard's write lock.
+func (c *Cache) untagLocked(e *entry) {
+	if len(e.tags) == 0 {
+		return
+	}
+	c.tags.mu.Lock()
+	defer c.tags.mu.Unlock()
+	for _, tag := range e.tags {
+		if keys := c.tags.keys[tag]; keys != nil {
+			delete(keys, e.key)
+			if len(keys) == 0 {
+				delete(c.tags.keys, tag)
+			}
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package infux
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// TierWritePolicy selects which tiers of a Tiered cache its writes go to.
+type TierWritePolicy int
+
+const (
+	// WriteThrough writes every item to both tiers, so the far tier
+	// always holds everything the near tier does.
+	WriteThrough TierWritePolicy = iota
+	// WriteBack writes items to the near tier only, and removes any older
+	// copy from the far tier. Items reach the far tier when the near tier
+	// evicts them to respect its limits. Items that expire in the near
+	// tier, or that it holds when the Tiered cache is closed, never reach
+	// the far tier.
+	WriteBack
+)
+
+// TieredConfig holds the options used to construct a Tiered cache with
+// NewTiered.
+type TieredConfig struct {
+	// Near and Far configure the two tiers. The near tier is meant to be
+	// small, with MaxEntries or MaxBytes set, and the far tier large. The
+	// tiers' own Loaders are ignored; use Loader instead.
+	Near Config
+	Far  Config
+
+	// Write selects which tiers writes go to. The default is
+	// WriteThrough.
+	Write TierWritePolicy
+
+	// Loader, if set, is called on a miss in both tiers, like
+	// Config.Loader. Concurrent misses of the same key share one load,
+	// and a loaded value is stored according to Write, expiring after
+	// LoaderTTL, or never if LoaderTTL is zero.
+	Loader    func(key string) ([]byte, error)
+	LoaderTTL time.Duration
+}
+
+// Tiered is a two-tier cache composed of a small near Cache in front of a
+// large far one, as in a near/far cache split: the hottest items are
+// served by the near tier, whose locks see less contention, while the far
+// tier keeps the bulk of the items. Reads check the near tier, then the
+// far tier, then the Loader. A hit in the far tier is promoted to the
+// near tier with its remaining time-to-live, so repeated reads of an item
+// move it near, and the near tier's eviction policy decides what stays
+// there. Writes follow the TierWritePolicy. A Tiered cache is safe for
+// concurrent use, but its operations are not atomic across the tiers: a
+// lookup racing with a write or delete of the same key may promote the
+// old value to the near tier.
+type Tiered struct {
+	near, far *Cache
+	write     TierWritePolicy
+	loader    func(key string) ([]byte, error)
+	loaderTTL time.Duration
+	flight    flightGroup
+
+	nearHits atomic.Uint64
+	farHits  atomic.Uint64
+	misses   atomic.Uint64
+}
+
+// TieredStats is a snapshot of the statistics of a Tiered cache.
+type TieredStats struct {
+	// Near and Far are the statistics of the tiers, as reported by their
+	// Stats.
+	Near, Far Stats
+	// NearHits and FarHits are the numbers of Tiered lookups served by
+	// the near and the far tier, and Misses the number that found the
+	// key in neither, whether or not the Loader then loaded it.
+	NearHits uint64
+	FarHits  uint64
+	Misses   uint64
+}
+
+// HitRatio returns the fraction of Tiered lookups served by either tier,
+// or 0 if no lookups have been made.
+func (s TieredStats) HitRatio() float64 {
+	hits := s.NearHits + s.FarHits
+	if hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+s.Misses)
+}
+
+// NewTiered creates a Tiered cache with its two tiers configured by cfg.
+// It panics if a tier's configuration is invalid, like NewWithConfig.
+func NewTiered(cfg TieredConfig) *Tiered {
+	return newTiered(cfg, realClock{})
+}
+
+// newTiered is NewTiered with both tiers reading the time from clk.
+func newTiered(cfg TieredConfig, clk clock) *Tiered {
+	t := &Tiered{write: cfg.Write, loader: cfg.Loader, loaderTTL: cfg.LoaderTTL}
+	cfg.Near.Loader, cfg.Far.Loader = nil, nil
+	t.far = newWithConfig(cfg.Far, clk)
+	if cfg.Write == WriteBack {
+		cfg.Near.OnEvict, cfg.Near.OnEvictBatch = nil, t.writeBack(cfg.Near.OnEvict, cfg.Near.OnEvictBatch)
+	}
+	t.near = newWithConfig(cfg.Near, clk)
+	return t
+}
+
+// writeTTL returns the ttl to give SetWithTTL to copy an item whose
+// remaining time-to-live, as reported by GetWithTTL or in an Entry, is
+// remaining, and reports whether the item is still live. NoExpiry maps to
+// zero, which SetWithTTL takes as no expiry, while a remaining time of
+// zero means the item has reached its deadline and must not be copied.
+func writeTTL(remaining time.Duration) (time.Duration, bool) {
+	switch {
+	case remaining == NoExpiry:
+		return 0, true
+	case remaining <= 0:
+		return 0, false
+	}
+	return remaining, true
+}
+
+// writeBack returns the eviction callback of the near tier with
+// WriteBack, which writes the items the near tier evicts to respect its
+// limits to the far tier, and then calls the callbacks configured for the
+// near tier, if any. Items evicted past their deadline, before they
+// could be removed as expired, are not written back.
+func (t *Tiered) writeBack(onEvict func(string, []byte, EvictReason), onEvictBatch func([]Entry, EvictReason)) func([]Entry, EvictReason) {
+	return func(entries []Entry, reason EvictReason) {
+		if reason == ReasonEvicted {
+			for _, e := range entries {
+				if ttl, live := writeTTL(e.TTL); live {
+					t.far.SetWithTTL(e.Key, e.Value, ttl)
+				}
+			}
+		}
+		switch {
+		case onEvictBatch != nil:
+			onEvictBatch(entries, reason)
+		case onEvict != nil:
+			for _, e := range entries {
+				onEvict(e.Key, e.Value, reason)
+			}
+		}
+	}
+}
+
+// Near returns the near tier, for example to read its statistics. Writing
+// to it directly bypasses the write policy.
+func (t *Tiered) Near() *Cache {
+	return t.near
+}
+
+// Far returns the far tier. Writing to it directly bypasses the write
+// policy.
+func (t *Tiered) Far() *Cache {
+	return t.far
+}
+
+// Get retrieves an item from the near tier, or else from the far tier,
+// promoting it to the near tier, or else through the Loader.
+func (t *Tiered) Get(key string) ([]byte, bool) {
+	if value, found := t.near.Get(key); found {
+		t.nearHits.Add(1)
+		return value, true
+	}
+	if value, remaining, found := t.far.GetWithTTL(key); found {
+		// An item found as its deadline passes counts as expired.
+		if ttl, live := writeTTL(remaining); live {
+			t.farHits.Add(1)
+			t.near.SetWithTTL(key, value, ttl)
+			return value, true
+		}
+	}
+	t.misses.Add(1)
+	if t.loader == nil {
+		return nil, false
+	}
+	value, err, _ := t.flight.do(context.Background(), key, func() ([]byte, error) {
+		value, err := t.loader(key)
+		if err != nil {
+			return nil, err
+		}
+		t.SetWithTTL(key, value, t.loaderTTL)
+		return value, nil
+	})
+	return value, err == nil
+}
+
+// Set adds an item to the tiers chosen by the write policy, replacing any
+// existing item. The item never expires.
+func (t *Tiered) Set(key string, value []byte) {
+	t.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL is like Set, but the item expires after ttl. A zero or
+// negative ttl means the item never expires.
+func (t *Tiered) SetWithTTL(key string, value []byte, ttl time.Duration) {
+	if t.write == WriteBack {
+		// Remove the far copy first, so that it cannot be promoted again
+		// once the new value has left the near tier.
+		t.far.Delete(key)
+	} else {
+		t.far.SetWithTTL(key, value, ttl)
+	}
+	t.near.SetWithTTL(key, value, ttl)
+}
+
+// Delete removes an item from both tiers.
+func (t *Tiered) Delete(key string) {
+	t.far.Delete(key)
+	t.near.Delete(key)
+}
+
+// Stats returns the statistics of the Tiered cache and of its tiers.
+func (t *Tiered) Stats() TieredStats {
+	return TieredStats{
+		Near:     t.near.Stats(),
+		Far:      t.far.Stats(),
+		NearHits: t.nearHits.Load(),
+		FarHits:  t.farHits.Load(),
+		Misses:   t.misses.Load(),
+	}
+}
+
+// Close closes both tiers, and returns their errors joined, such as
+// ErrClosed if the Tiered cache was already closed.
+func (t *Tiered) Close() error {
+	return errors.Join(t.near.Close(), t.far.Close())
+}
@@ -0,0 +1,74 @@
+package infux
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTieredWriteBackSkipsExpiredItems(t *testing.T) {
+	clk := newFakeClock(time.Unix(1000, 0))
+	tc := newTiered(TieredConfig{Near: Config{MaxEntries: 1, Shards: 1}, Write: WriteBack}, clk)
+	tc.SetWithTTL("a", []byte("stale"), 20*time.Millisecond)
+	clk.Advance(40 * time.Millisecond)
+	tc.Set("b", []byte("v"))
+	if _, ttl, found := tc.Far().GetWithTTL("a"); found {
+		t.Fatalf("expired item written back to the far tier with TTL %v", ttl)
+	}
+	if v, found := tc.Get("a"); found {
+		t.Fatalf("Get = %q for an item evicted after it expired", v)
+	}
+}
+
+func TestTieredWriteBackKeepsRemainingTTL(t *testing.T) {
+	clk := newFakeClock(time.Unix(1000, 0))
+	tc := newTiered(TieredConfig{Near: Config{MaxEntries: 1, Shards: 1}, Write: WriteBack}, clk)
+	tc.SetWithTTL("a", []byte("1"), time.Minute)
+	clk.Advance(20 * time.Second)
+	tc.Set("b", []byte("2"))
+	if _, ttl, found := tc.Far().GetWithTTL("a"); !found || ttl != 40*time.Second {
+		t.Fatalf("far tier holds a: %v, TTL %v, want its remaining 40s", found, ttl)
+	}
+	tc.Set("c", []byte("3"))
+	if _, ttl, found := tc.Far().GetWithTTL("b"); !found || ttl != NoExpiry {
+		t.Fatalf("far tier holds b: %v, TTL %v, want it never to expire", found, ttl)
+	}
+}
+
+func TestTieredPromotionKeepsExpiry(t *testing.T) {
+	clk := newFakeClock(time.Unix(1000, 0))
+	tc := newTiered(TieredConfig{}, clk)
+	tc.SetWithTTL("ttl", []byte("1"), time.Minute)
+	tc.Set("forever", []byte("2"))
+	tc.Near().Clear()
+	clk.Advance(20 * time.Second)
+	for _, tt := range []struct {
+		key string
+		ttl time.Duration
+	}{{"ttl", 40 * time.Second}, {"forever", NoExpiry}} {
+		if _, found := tc.Get(tt.key); !found {
+			t.Fatalf("Get(%q) missed the far tier", tt.key)
+		}
+		if _, ttl, found := tc.Near().GetWithTTL(tt.key); !found || ttl != tt.ttl {
+			t.Fatalf("promoted %q: %v, TTL %v, want TTL %v", tt.key, found, ttl, tt.ttl)
+		}
+	}
+	clk.Advance(40 * time.Second)
+	if tc.Near().Has("ttl") {
+		t.Fatal("promoted item outlived its far-tier deadline")
+	}
+}
+
+func TestWriteTTL(t *testing.T) {
+	for _, tt := range []struct {
+		remaining, ttl time.Duration
+		live           bool
+	}{
+		{NoExpiry, 0, true},
+		{0, 0, false},
+		{time.Second, time.Second, true},
+	} {
+		if ttl, live := writeTTL(tt.remaining); ttl != tt.ttl || live != tt.live {
+			t.Errorf("writeTTL(%v) = %v, %v, want %v, %v", tt.remaining, ttl, live, tt.ttl, tt.live)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package infux
+
+import (
+	"context"
+	"strconv"
+)
+
+// Tracer starts spans for the cache operations made through GetCtx and
+// SetCtx, as set with Config.Tracer. It is deliberately small, so that a
+// tracing library such as OpenTelemetry can be adapted to it in a few
+// lines without the cache depending on it. A Tracer must be safe for
+// concurrent use.
+type Tracer interface {
+	// Start starts a span for the operation op, "infux.Get" or
+	// "infux.Set", on key, as a child of the span in ctx, if any. The key
+	// is hashed first with Config.HashTraceKeys.
+	Start(ctx context.Context, op, key string) Span
+}
+
+// Span is a span started by a Tracer. The span's start and end times
+// record the duration of the operation.
+type Span interface {
+	// SetHit records whether a lookup found the key. It is only called
+	// for lookups, just before End.
+	SetHit(hit bool)
+	// End ends the span.
+	End()
+}
+
+// traceKey returns the key to pass to the Tracer for key.
+func (c *Cache) traceKey(key string) string {
+	if !c.hashTraceKeys {
+		return key
+	}
+	return strconv.FormatUint(bloomHash(key), 16)
+}
+
+// GetCtx is like Get, but with Config.Tracer, records the lookup as a
+// span, a child of the span in ctx, noting whether it was a hit. Without
+// a Tracer, it is Get: ctx is ignored, and no time is spent tracing.
+func (c *Cache) GetCtx(ctx context.Context, key string) ([]byte, bool) {
+	if c.tracer == nil {
+		return c.Get(key)
+	}
+	span := c.tracer.Start(ctx, "infux.Get", c.traceKey(c.normalize(key)))
+	value, found := c.Get(key)
+	span.SetHit(found)
+	span.End()
+	return value, found
+}
+
+// SetCtx is like Set, but with Config.Tracer, records the write as a
+// span, a child of the span in ctx. Without a Tracer, it is Set.
+func (c *Cache) SetCtx(ctx context.Context, key string, value []byte) {
+	if c.tracer == nil {
+		c.Set(key, value)
+		return
+	}
+	span := c.tracer.Start(ctx, "infux.Set", c.traceKey(c.normalize(key)))
+	c.Set(key, value)
+	span.End()
+}
@@ -0,0 +1,333 @@
+package infux
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// SetWithTTL adds an item to the cache that expires after ttl, replacing
+// any existing item. A zero or negative ttl means the item never expires.
+// SetWithTTL is a no-op on a closed cache.
+func (c *Cache) SetWithTTL(key string, value []byte, ttl time.Duration) {
+	c.setWithTTL(c.normalize(key), value, ttl)
+}
+
+// setWithTTL implements SetWithTTL for a normalized key, returning the
+// error TrySet would.
+func (c *Cache) setWithTTL(key string, value []byte, ttl time.Duration) error {
+	if c.latency != nil {
+		defer c.recordLatency(&c.latency.set, key, time.Now())
+	}
+	if c.skipEqualWrite(key, value, ttl) {
+		return nil
+	}
+	return c.set(c.newTTLEntry(key, value, ttl))
+}
+
+// SetWithTTLReplaced is like SetWithTTL, but reports whether the item
+// replaced a live item under key, rather than being new or replacing an
+// expired one, for example to count fresh cache population apart from
+// refreshes. The check and the write take place under the same shard
+// lock, so a concurrent write of the key cannot slip in between. It
+// returns false if nothing was stored, for example on a closed cache.
+// With Config.SkipEqualWrites, a write skipped over an equal value counts
+// as a replacement.
+func (c *Cache) SetWithTTLReplaced(key string, value []byte, ttl time.Duration) bool {
+	key = c.normalize(key)
+	if c.latency != nil {
+		defer c.recordLatency(&c.latency.set, key, time.Now())
+	}
+	if c.skipEqualWrite(key, value, ttl) {
+		return true
+	}
+	replaced, _ := c.replace(c.newTTLEntry(key, value, ttl))
+	return replaced
+}
+
+// SetWithDeadline adds an item to the cache that expires at deadline,
+// replacing any existing item, for example to cache a token until its
+// expiry claim. The item counts as expired from deadline on, exactly:
+// Config.TTLJitter is not applied. A zero deadline means the item never
+// expires. A deadline that is not after the current time deletes any
+// existing item instead, like Delete, and stores nothing.
+// SetWithDeadline is a no-op on a closed cache.
+func (c *Cache) SetWithDeadline(key string, value []byte, deadline time.Time) {
+	key = c.normalize(key)
+	if deadline.IsZero() {
+		c.setWithTTL(key, value, 0)
+		return
+	}
+	now, at := c.now(), deadline.UnixNano()
+	if at <= now {
+		c.delete(key)
+		return
+	}
+	if c.latency != nil {
+		defer c.recordLatency(&c.latency.set, key, time.Now())
+	}
+	ttl := time.Duration(at - now)
+	if c.skipEqualWriteAt(key, value, ttl, at) {
+		return
+	}
+	e := c.newEntry(key, value)
+	e.ttl, e.expiresAt = ttl, at
+	c.set(e)
+}
+
+// newTTLEntry returns an entry for value, which was passed in by the
+// caller, written now that expires after ttl, or never if ttl is zero or
+// negative.
+func (c *Cache) newTTLEntry(key string, value []byte, ttl time.Duration) *entry {
+	e := c.newEntry(key, value)
+	e.setTTL(ttl, c.now())
+	c.jitter(e)
+	return e
+}
+
+// jitter moves the expiry of e, if it has one, by a random offset within
+// plus or minus Config.TTLJitter.
+func (c *Cache) jitter(e *entry) {
+	if c.ttlJitter > 0 && e.expiresAt != 0 {
+		e.expiresAt += rand.Int63n(2*int64(c.ttlJitter)+1) - int64(c.ttlJitter)
+	}
+}
+
+// setTTL makes e expire after ttl from now, in Unix nanoseconds, or never
+// if ttl is zero or negative.
+func (e *entry) setTTL(ttl time.Duration, now int64) {
+	if ttl <= 0 {
+		e.ttl, e.expiresAt = 0, 0
+		return
+	}
+	e.ttl = ttl
+	e.expiresAt = now + int64(ttl)
+}
+
+// keepExpiry copies the expiry settings of old to e, so that a value
+// written over an existing item keeps the item's expiry.
+func (e *entry) keepExpiry(old *entry) *entry {
+	e.expiresAt = old.expiresAt
+	e.ttl = old.ttl
+	e.maxIdle = old.maxIdle
+	e.usedAt.Store(old.usedAt.Load())
+	return e
+}
+
+// deadline returns the time e expires at unless it is used meanwhile, in
+// Unix nanoseconds: the earlier of its expiry time and, if it has a max
+// idle time, the end of its idle time, or 0 if it never expires.
+func (e *entry) deadline() int64 {
+	if e.maxIdle == 0 {
+		return e.expiresAt
+	}
+	idle := e.usedAt.Load() + int64(e.maxIdle)
+	if e.expiresAt != 0 && e.expiresAt < idle {
+		return e.expiresAt
+	}
+	return idle
+}
+
+// SetWithMaxIdle adds an item to the cache that expires once it has gone
+// unused for longer than maxIdle, replacing any existing item: every
+// lookup that finds it, such as Get, starts its idle time over, so an
+// item in use never expires, unlike with a TTL. Peek and other reads
+// without side effects do not count as uses. The item has no absolute
+// expiry, but one can be added with Touch, after which it expires at
+// whichever of its TTL or its idle time runs out first; the TTL is then
+// extended by lookups in sliding expiration mode, as for any item, while
+// the idle time never is by anything but lookups. Writes that keep an
+// item's expiry, such as Update, also keep its max idle time. Like TTLs,
+// idle items are removed lazily or by the sweeper. A zero or negative
+// maxIdle means the item never expires, like Set. SetWithMaxIdle is a
+// no-op on a closed cache.
+func (c *Cache) SetWithMaxIdle(key string, value []byte, maxIdle time.Duration) {
+	key = c.normalize(key)
+	e := c.newEntry(key, value)
+	if maxIdle > 0 {
+		e.maxIdle = maxIdle
+		e.usedAt.Store(c.now())
+	}
+	c.set(e)
+}
+
+// NoExpiry is the remaining time-to-live reported for items that never
+// expire.
+const NoExpiry time.Duration = -1
+
+// GetWithTTL retrieves an item from the cache together with its remaining
+// time-to-live. The remaining time is NoExpiry for items without an
+// expiry. Expired items are reported as not found. Like Get, it records
+// the lookup in the statistics and updates recency and sliding expiry.
+func (c *Cache) GetWithTTL(key string) ([]byte, time.Duration, bool) {
+	key = c.normalize(key)
+	shard, write := c.lockLookupShard(key)
+	defer c.unlockLookup(shard, write)
+	e, found := c.lookupLocked(shard, key, write)
+	if !found {
+		return nil, 0, false
+	}
+	at := e.deadline()
+	if at == 0 {
+		return c.valueOut(e), NoExpiry, true
+	}
+	// Clamp at zero so that an item expiring right now is not mistaken
+	// for one that never expires.
+	return c.valueOut(e), max(time.Duration(at-c.now()), 0), true
+}
+
+// Touch resets the expiry of key to ttl from now without rewriting its
+// value, and reports whether the key was present. A zero or negative ttl
+// makes the item never expire. The new ttl is also used by later lookups
+// in sliding expiration mode. Touch returns false on a closed cache.
+func (c *Cache) Touch(key string, ttl time.Duration) bool {
+	key = c.normalize(key)
+	if c.writeErr() != nil {
+		return false
+	}
+	shard := c.lockShard(key)
+	defer c.unlock(shard)
+	e, found := c.liveLocked(shard, key)
+	if !found {
+		return false
+	}
+	e.setTTL(ttl, c.now())
+	c.jitter(e)
+	c.reindexLocked(e)
+	c.scheduleLocked(shard, e)
+	if c.bounded {
+		c.accessLocked(shard, e)
+	}
+	return true
+}
+
+// ExpiringSoon returns up to limit live items with the nearest expiry
+// times, the soonest first, for example to show what expires next in an
+// admin view, or to refresh items before they lapse. Items that never
+// expire are not included, and items written with SetWithMaxIdle count
+// as expiring when their idle time runs out. TTL holds each item's
+// remaining time-to-live. ExpiringSoon scans every item of the cache,
+// one shard at a time under the shard's read lock, and keeps the best
+// candidates in a buffer sorted whenever it fills up, so it takes time
+// proportional to the number of items times the logarithm of limit: not
+// free, but fine for occasional diagnostics. Like ForEach, the result
+// is consistent per shard only. It returns nil if limit is zero or
+// negative.
+func (c *Cache) ExpiringSoon(limit int) []Entry {
+	if limit <= 0 {
+		return nil
+	}
+	type candidate struct {
+		e  *entry
+		at int64
+	}
+	var candidates []candidate
+	trim := func() {
+		slices.SortFunc(candidates, func(a, b candidate) int { return cmp.Compare(a.at, b.at) })
+		if len(candidates) > limit {
+			candidates = candidates[:limit]
+		}
+	}
+	for _, shard := range c.table().shards {
+		shard.mu.RLock()
+		now := c.now()
+		for _, e := range shard.items {
+			if at := e.deadline(); at != 0 && now < at {
+				candidates = append(candidates, candidate{e.pinned(), at})
+			}
+		}
+		shard.mu.RUnlock()
+		if len(candidates)-limit >= limit {
+			trim()
+		}
+	}
+	trim()
+	now := c.now()
+	entries := make([]Entry, len(candidates))
+	for i, cand := range candidates {
+		// The value of an entry never changes, so it may be read after
+		// the shard's lock is released.
+		entries[i] = Entry{Key: cand.e.key, Value: c.valueOut(cand.e), TTL: max(time.Duration(cand.at-now), 0)}
+	}
+	return entries
+}
+
+// DeleteExpired removes every expired item from the cache, as the
+// background sweeper enabled by Config.CleanupInterval does, and returns
+// the number of items removed. It lets callers run expiration sweeps on
+// their own schedule instead of with a timer goroutine. Shards are locked
+// one at a time, and removed items are reported to OnEvict with
+// ReasonExpired, or to OnEvictBatch in a single batch once every shard
+// has been swept. It takes time proportional to the number of items, or
+// with Config.BucketedExpiry, to the number of items whose expiry time
+// has come. DeleteExpired returns 0 on a closed cache.
+func (c *Cache) DeleteExpired() int {
+	if c.closed.Load() {
+		return 0
+	}
+	now := c.now()
+	removed := 0
+	var expired []eviction
+	for _, shard := range c.table().shards {
+		removed += c.deleteExpired(shard, now, &expired)
+	}
+	if len(expired) > 0 {
+		c.deliver(expired)
+	}
+	return removed
+}
+
+// deleteExpired removes all expired items from shard and returns the
+// number of items removed. With OnEvictBatch, the removed items are
+// appended to expired instead of being delivered when the shard is
+// unlocked.
+func (c *Cache) deleteExpired(shard *cacheShard, now int64, expired *[]eviction) int {
+	shard.mu.Lock()
+	defer c.unlock(shard)
+	defer func() {
+		if c.onEvictBatch != nil {
+			// Hold the expired items back for a single batch per sweep.
+			*expired = append(*expired, shard.evicted...)
+			shard.evicted = nil
+		}
+	}()
+	removed := 0
+	if c.bucketWidth > 0 {
+		removed = c.sweepBucketsLocked(shard, now)
+	} else {
+		for _, e := range shard.items {
+			if e.expired(now) {
+				c.evictLocked(shard, e, ReasonExpired)
+				removed++
+			}
+		}
+	}
+	for key, expiresAt := range shard.negative {
+		if now >= expiresAt {
+			delete(shard.negative, key)
+		}
+	}
+	return removed
+}
+
+// runCleanup sweeps every shard of c once per interval until stop is
+// closed. Shards are locked one at a time so readers and writers on
+// other shards are never blocked by the sweep.
+func (c *Cache) runCleanup(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			start := time.Now()
+			if removed := c.DeleteExpired(); removed > 0 {
+				c.logger.Debug("infux: swept expired items", "removed", removed, "duration", time.Since(start))
+			}
+			c.drainOverflow()
+			c.compactSparse()
+		case <-stop:
+			return
+		}
+	}
+}
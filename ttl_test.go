@@ -0,0 +1,60 @@
+package infux
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetWithDeadline(t *testing.T) {
+	c, clk := newTestCache(Config{TTLJitter: time.Second})
+	c.SetWithDeadline("k", []byte("v"), clk.Now().Add(time.Minute))
+	e := c.getShard("k").items["k"]
+	if want := clk.Now().Add(time.Minute).UnixNano(); e.expiresAt != want {
+		t.Fatalf("expiresAt = %d, want exactly %d", e.expiresAt, want)
+	}
+	clk.Advance(time.Minute)
+	if c.Has("k") {
+		t.Fatal("item live at its deadline")
+	}
+	c.Set("gone", []byte("v"))
+	c.SetWithDeadline("gone", []byte("v"), clk.Now())
+	if c.Has("gone") {
+		t.Fatal("deadline in the past did not delete the item")
+	}
+}
+
+func TestSetWithDeadlineSkipsEqualWrites(t *testing.T) {
+	c, clk := newTestCache(Config{SkipEqualWrites: true, TrackLatency: true})
+	c.SetWithDeadline("k", []byte("v"), clk.Now().Add(time.Minute))
+	first := c.getShard("k").items["k"]
+	deadline := clk.Now().Add(time.Hour)
+	c.SetWithDeadline("k", []byte("v"), deadline)
+	e := c.getShard("k").items["k"]
+	if e != first {
+		t.Fatal("write of an equal value replaced the item")
+	}
+	if e.expiresAt != deadline.UnixNano() {
+		t.Fatal("skipped write did not move the deadline")
+	}
+	if n := c.LatencyStats().Set.Count; n != 2 {
+		t.Fatalf("recorded %d set latencies, want 2", n)
+	}
+}
+
+func TestSetWithDeadlineNormalizesOnce(t *testing.T) {
+	var calls int
+	c, clk := newTestCache(Config{KeyNormalizer: func(key string) string {
+		calls++
+		return strings.ToLower(key)
+	}})
+	c.Set("k", []byte("v"))
+	calls = 0
+	c.SetWithDeadline("K", []byte("v"), clk.Now())
+	if c.Has("k") {
+		t.Fatal("deadline in the past did not delete the normalized key")
+	}
+	if calls != 2 {
+		t.Fatalf("KeyNormalizer called %d times for SetWithDeadline and Has, want 2", calls)
+	}
+}
@@ -0,0 +1,158 @@
+package infux
+
+import (
+	"sort"
+	"time"
+)
+
+// Txn gives access to the keys declared to Transaction while it holds
+// their shards' locks. Writes are buffered and applied together when the
+// transaction's function returns, and reads see the transaction's own
+// writes. A Txn is only valid during the call to Transaction's function,
+// and its methods panic after it returns, or if given a key that was not
+// declared.
+type Txn struct {
+	c      *Cache
+	shards map[string]*cacheShard
+	// locked are the locked shards, in locking order.
+	locked []*cacheShard
+	// writes are the buffered writes by key, with nil for a delete.
+	writes map[string]*entry
+	active bool
+}
+
+// Transaction locks the shards of keys and calls fn with a Txn through
+// which it can read and write those keys, and only those. Other
+// goroutines observe either none or all of the writes made through the
+// Txn, which are applied after fn returns; if fn panics, none of them
+// are. Shards are locked in index order, so concurrent transactions
+// cannot deadlock, but the more shards the keys span, the more of the
+// cache is blocked while fn runs: fn must not use the cache other than
+// through the Txn, and should return quickly. Cache-wide limits are
+// enforced as usual once the writes are applied, and an item rejected by
+// them, as by TrySet, is not stored. Transaction does not call fn on a
+// closed cache.
+func (c *Cache) Transaction(keys []string, fn func(txn *Txn)) {
+	if c.closed.Load() {
+		return
+	}
+	t := &Txn{c: c, writes: make(map[string]*entry)}
+	t.lock(keys)
+	defer t.unlock()
+	t.active = true
+	fn(t)
+	t.active = false
+	if c.frozen.Load() {
+		return
+	}
+	for key, e := range t.writes {
+		shard := t.shards[key]
+		if e != nil {
+			c.insertLocked(shard, e)
+		} else if old, found := shard.items[key]; found {
+			c.deleteLocked(shard, old)
+		}
+	}
+}
+
+// lock locks the shards of keys in index order, starting over if a
+// concurrent Resize moved any of them.
+func (t *Txn) lock(keys []string) {
+	for {
+		table := t.c.table()
+		t.shards = make(map[string]*cacheShard, len(keys))
+		var indexes []int
+		seen := make(map[int]bool)
+		for _, key := range keys {
+			key = t.c.normalize(key)
+			i := int(t.c.hash(key) & table.mask)
+			t.shards[key] = table.shards[i]
+			if !seen[i] {
+				seen[i] = true
+				indexes = append(indexes, i)
+			}
+		}
+		sort.Ints(indexes)
+		t.locked = t.locked[:0]
+		moved := false
+		for _, i := range indexes {
+			shard := table.shards[i]
+			shard.mu.Lock()
+			t.locked = append(t.locked, shard)
+			if shard.moved {
+				moved = true
+				break
+			}
+		}
+		if !moved {
+			return
+		}
+		for _, shard := range t.locked {
+			shard.mu.Unlock()
+		}
+	}
+}
+
+// unlock releases the shards' locks and evicts from other shards if the
+// writes left the cache over its limits.
+func (t *Txn) unlock() {
+	t.active = false
+	for _, shard := range t.locked {
+		t.c.unlock(shard)
+	}
+	for _, shard := range t.locked {
+		t.c.evictOverflow(shard)
+	}
+}
+
+// shard returns the normalized key and its locked shard, panicking if
+// the Txn is no longer valid or key was not declared.
+func (t *Txn) shard(key string) (string, *cacheShard) {
+	if !t.active {
+		panic("infux: Txn used after Transaction returned")
+	}
+	key = t.c.normalize(key)
+	shard, ok := t.shards[key]
+	if !ok {
+		panic("infux: Txn used with undeclared key " + key)
+	}
+	return key, shard
+}
+
+// Get retrieves an item, like Cache.Get without the Loader, seeing the
+// transaction's own writes.
+func (t *Txn) Get(key string) ([]byte, bool) {
+	key, shard := t.shard(key)
+	if e, written := t.writes[key]; written {
+		if e == nil {
+			return nil, false
+		}
+		return t.c.valueOut(e), true
+	}
+	e, found := t.c.lookupLocked(shard, key, true)
+	if !found {
+		return nil, false
+	}
+	return t.c.valueOut(e), true
+}
+
+// Set stores an item when the transaction is applied, replacing any
+// existing item, like Cache.Set.
+func (t *Txn) Set(key string, value []byte) {
+	key, _ = t.shard(key)
+	t.writes[key] = t.c.newEntry(key, value)
+}
+
+// SetWithTTL stores an item that expires after ttl when the transaction
+// is applied, like Cache.SetWithTTL.
+func (t *Txn) SetWithTTL(key string, value []byte, ttl time.Duration) {
+	key, _ = t.shard(key)
+	t.writes[key] = t.c.newTTLEntry(key, value, ttl)
+}
+
+// Delete removes an item when the transaction is applied, like
+// Cache.Delete.
+func (t *Txn) Delete(key string) {
+	key, _ = t.shard(key)
+	t.writes[key] = nil
+}
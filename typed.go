@@ -0,0 +1,109 @@
+package infux
+
+import (
+	"sync"
+	"time"
+)
+
+// TypedCache is a thread-safe, sharded in-memory cache that stores values
+// of type V directly, without serializing them to bytes.
+//
+// It uses the same sharding scheme as Cache. Values are stored and
+// returned as is, so a stored pointer, slice or map is shared with the
+// caller.
+type TypedCache[V any] struct {
+	shards [defaultShardCount]*typedShard[V]
+	// clock tells the time for expiry.
+	clock clock
+}
+
+// typedShard is a single shard of a TypedCache.
+type typedShard[V any] struct {
+	items map[string]typedEntry[V]
+	mu    sync.RWMutex
+}
+
+// typedEntry is a single value stored in a TypedCache.
+type typedEntry[V any] struct {
+	value V
+	// expiresAt is the expiry time in Unix nanoseconds, or 0 if the
+	// entry never expires.
+	expiresAt int64
+}
+
+// NewTyped creates and returns a new TypedCache instance.
+func NewTyped[V any]() *TypedCache[V] {
+	c := &TypedCache[V]{clock: realClock{}}
+	for i := range c.shards {
+		c.shards[i] = &typedShard[V]{
+			items: make(map[string]typedEntry[V]),
+		}
+	}
+	return c
+}
+
+// getShard returns the cache shard for a given key.
+func (c *TypedCache[V]) getShard(key string) *typedShard[V] {
+	return c.shards[hashKey(key)&(defaultShardCount-1)]
+}
+
+// Set adds an item to the cache, replacing any existing item.
+// The item never expires.
+func (c *TypedCache[V]) Set(key string, value V) {
+	c.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL adds an item to the cache that expires after ttl, replacing
+// any existing item. A zero or negative ttl means the item never expires.
+func (c *TypedCache[V]) SetWithTTL(key string, value V, ttl time.Duration) {
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = c.clock.Now().Add(ttl).UnixNano()
+	}
+	shard := c.getShard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.items[key] = typedEntry[V]{value: value, expiresAt: expiresAt}
+}
+
+// Get retrieves an item from the cache. It returns the value and a
+// boolean indicating whether the key was found. On a miss, including an
+// expired item, the zero value of V is returned.
+func (c *TypedCache[V]) Get(key string) (V, bool) {
+	shard := c.getShard(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	e, found := shard.items[key]
+	if !found || e.expiresAt != 0 && c.clock.Now().UnixNano() >= e.expiresAt {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Delete removes an item from the cache.
+func (c *TypedCache[V]) Delete(key string) {
+	shard := c.getShard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	delete(shard.items, key)
+}
+
+// Len returns the total number of items in the cache.
+// Expired items that have not been overwritten or deleted are included
+// in the count.
+func (c *TypedCache[V]) Len() int {
+	total := 0
+	for _, shard := range c.shards {
+		shard.mu.RLock()
+		total += len(shard.items)
+		shard.mu.RUnlock()
+	}
+	return total
+}
+
+// Has checks if a key exists in the cache.
+func (c *TypedCache[V]) Has(key string) bool {
+	_, found := c.Get(key)
+	return found
+}